@@ -8,6 +8,7 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"syscall"
@@ -15,6 +16,8 @@ import (
 
 	"git.sr.ht/~kota/kudoer/application/mail"
 	"git.sr.ht/~kota/kudoer/application/media"
+	"git.sr.ht/~kota/kudoer/application/webauthn"
+	"git.sr.ht/~kota/kudoer/db/litesession"
 	"git.sr.ht/~kota/kudoer/db/models"
 	"github.com/alexedwards/scs/v2"
 	"github.com/justinas/nosurf"
@@ -24,11 +27,17 @@ import (
 type application struct {
 	infoLog        *log.Logger
 	errLog         *log.Logger
+	baseURL        string
+	admins         []string
+	allowRevisits  bool
+	trustedProxies []netip.Prefix
 	templates      map[string]*template.Template
 	sessionManager *scs.SessionManager
+	sessionStore   *litesession.SQLitexStore
 	rateLimiter    *throttled.HTTPRateLimiterCtx
 	mediaStore     *media.MediaStore
 	mailer         *mail.Mailer
+	relyingParty   webauthn.Config
 
 	users       *models.UserModel
 	items       *models.ItemModel
@@ -36,37 +45,74 @@ type application struct {
 	search      *models.SearchModel
 	pwresets    *models.PWResetModel
 	profilepics *models.ProfilePictureModel
+	itemImages  *models.ItemImageModel
+
+	notifications *models.NotificationModel
+	digests       *models.DigestModel
+	outbox        *models.OutboxModel
+	verifications *models.VerificationModel
+	twoFactor     *models.TwoFactorModel
+	passkeys      *models.PasskeyModel
+	loginAttempts *models.LoginAttemptModel
 }
 
 func New(
 	infoLog *log.Logger,
 	errLog *log.Logger,
+	baseURL string,
+	admins []string,
+	allowRevisits bool,
+	trustedProxies []netip.Prefix,
 	templates map[string]*template.Template,
 	sessionManager *scs.SessionManager,
+	sessionStore *litesession.SQLitexStore,
 	rateLimiter *throttled.HTTPRateLimiterCtx,
 	mediaStore *media.MediaStore,
 	mailer *mail.Mailer,
+	relyingParty webauthn.Config,
 	users *models.UserModel,
 	items *models.ItemModel,
 	kudos *models.KudoModel,
 	search *models.SearchModel,
 	pwresets *models.PWResetModel,
 	profilepics *models.ProfilePictureModel,
+	itemImages *models.ItemImageModel,
+	notifications *models.NotificationModel,
+	digests *models.DigestModel,
+	outbox *models.OutboxModel,
+	verifications *models.VerificationModel,
+	twoFactor *models.TwoFactorModel,
+	passkeys *models.PasskeyModel,
+	loginAttempts *models.LoginAttemptModel,
 ) *application {
 	return &application{
 		infoLog:        infoLog,
 		errLog:         errLog,
+		baseURL:        baseURL,
+		admins:         admins,
+		allowRevisits:  allowRevisits,
+		trustedProxies: trustedProxies,
 		templates:      templates,
 		sessionManager: sessionManager,
+		sessionStore:   sessionStore,
 		rateLimiter:    rateLimiter,
 		mediaStore:     mediaStore,
 		mailer:         mailer,
+		relyingParty:   relyingParty,
 		users:          users,
 		items:          items,
 		kudos:          kudos,
 		search:         search,
 		pwresets:       pwresets,
 		profilepics:    profilepics,
+		itemImages:     itemImages,
+		notifications:  notifications,
+		digests:        digests,
+		outbox:         outbox,
+		verifications:  verifications,
+		twoFactor:      twoFactor,
+		passkeys:       passkeys,
+		loginAttempts:  loginAttempts,
 	}
 }
 
@@ -75,23 +121,40 @@ type Page struct {
 	CSPNonce        string
 	CSRFToken       string
 	Flash           string
+	UndoKudo        string
 	Authenticated   string
 	Title           string
 	PageDescription string
+
+	// Unread is how many unread notifications the current user has.
+	Unread int
 }
 
 func (app *application) newPage(r *http.Request, title, description string) Page {
 	cspNonce := nonce(r.Context())
 	csrfToken := nosurf.Token(r)
 	flash := app.sessionManager.PopString(r.Context(), "flash")
+	undoKudo := app.sessionManager.PopString(r.Context(), "undoKudo")
 	authenticated := app.authenticated(r)
+
+	// A missing notification count shouldn't stop the page from working.
+	var unread int
+	if authenticated != "" {
+		var err error
+		unread, err = app.notifications.Unread(r.Context(), authenticated)
+		if err != nil {
+			app.errLog.Println("failed counting notifications:", err)
+		}
+	}
 	return Page{
 		CSPNonce:        cspNonce,
 		CSRFToken:       csrfToken,
 		Flash:           flash,
+		UndoKudo:        undoKudo,
 		Authenticated:   authenticated,
 		Title:           title,
 		PageDescription: description,
+		Unread:          unread,
 	}
 }
 
@@ -105,6 +168,17 @@ func (app *application) Serve(addr string) error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go app.purgeKudos(ctx)
+	go app.sendDigests(ctx)
+	go app.purgeLoginAttempts(ctx)
+	mailStopped := make(chan struct{})
+	go func() {
+		app.sendMail(ctx)
+		close(mailStopped)
+	}()
+
 	// Handle shutdown signals gracefully.
 	shutdownError := make(chan error)
 	go func() {
@@ -128,6 +202,10 @@ func (app *application) Serve(addr string) error {
 	}
 
 	err = <-shutdownError
+
+	// Let the mail sender finish the message it is sending.
+	stop()
+	<-mailStopped
 	if err != nil {
 		return err
 	}
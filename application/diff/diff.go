@@ -0,0 +1,126 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package diff
+
+import "unicode"
+
+// Op describes what happened to a segment of text between two versions.
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Segment is a run of text which was kept, inserted, or deleted.
+type Segment struct {
+	Op   Op
+	Text string
+}
+
+// Inserted reports if the segment only exists in the new text.
+func (s Segment) Inserted() bool {
+	return s.Op == Insert
+}
+
+// Deleted reports if the segment only exists in the old text.
+func (s Segment) Deleted() bool {
+	return s.Op == Delete
+}
+
+// maxCells limits the size of the table used to compute a diff. Larger inputs
+// are shown as a complete replacement.
+const maxCells = 1 << 20
+
+// Words returns a word by word diff which turns a into b.
+func Words(a, b string) []Segment {
+	if a == b {
+		if a == "" {
+			return nil
+		}
+		return []Segment{{Op: Equal, Text: a}}
+	}
+
+	x := tokenize(a)
+	y := tokenize(b)
+	if len(x)*len(y) > maxCells {
+		var segments []Segment
+		segments = appendSegment(segments, Delete, a)
+		segments = appendSegment(segments, Insert, b)
+		return segments
+	}
+
+	// lcs[i][j] holds the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var segments []Segment
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			segments = appendSegment(segments, Equal, x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			segments = appendSegment(segments, Delete, x[i])
+			i++
+		default:
+			segments = appendSegment(segments, Insert, y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		segments = appendSegment(segments, Delete, x[i])
+	}
+	for ; j < len(y); j++ {
+		segments = appendSegment(segments, Insert, y[j])
+	}
+	return segments
+}
+
+// appendSegment adds text to the list of segments, merging it into the last
+// segment if they share the same operation.
+func appendSegment(segments []Segment, op Op, text string) []Segment {
+	if text == "" {
+		return segments
+	}
+	if n := len(segments); n > 0 && segments[n-1].Op == op {
+		segments[n-1].Text += text
+		return segments
+	}
+	return append(segments, Segment{Op: op, Text: text})
+}
+
+// tokenize splits text into alternating runs of whitespace and non-whitespace.
+// Joining the tokens together results in the original text.
+func tokenize(s string) []string {
+	var tokens []string
+	start := 0
+	var prevSpace bool
+	for i, r := range s {
+		space := unicode.IsSpace(r)
+		if i > start && space != prevSpace {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+		prevSpace = space
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
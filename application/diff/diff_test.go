@@ -0,0 +1,68 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	type test struct {
+		description string
+		a           string
+		b           string
+		want        []Segment
+	}
+
+	tests := []test{
+		{
+			description: "Both blank",
+			a:           "",
+			b:           "",
+			want:        nil,
+		},
+		{
+			description: "Unchanged",
+			a:           "The Hobbit",
+			b:           "The Hobbit",
+			want:        []Segment{{Op: Equal, Text: "The Hobbit"}},
+		},
+		{
+			description: "Typo fixed",
+			a:           "The Hobit",
+			b:           "The Hobbit",
+			want: []Segment{
+				{Op: Equal, Text: "The "},
+				{Op: Delete, Text: "Hobit"},
+				{Op: Insert, Text: "Hobbit"},
+			},
+		},
+		{
+			description: "Word added",
+			a:           "A book",
+			b:           "A good book",
+			want: []Segment{
+				{Op: Equal, Text: "A "},
+				{Op: Insert, Text: "good "},
+				{Op: Equal, Text: "book"},
+			},
+		},
+		{
+			description: "Everything removed",
+			a:           "gone",
+			b:           "",
+			want:        []Segment{{Op: Delete, Text: "gone"}},
+		},
+	}
+
+	for _, tc := range tests {
+		got := Words(tc.a, tc.b)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf(
+				"%v: got: \"%v\" want: \"%v\"\n",
+				tc.description,
+				got,
+				tc.want,
+			)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package application
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"git.sr.ht/~kota/kudoer/db/models"
+)
+
+// digestInterval is how often the server checks for digests which are due.
+const digestInterval = 10 * time.Minute
+
+// digestEmail is the data given to the digest email templates.
+type digestEmail struct {
+	models.Digest
+	Unsubscribe string
+	Expiry      time.Time
+}
+
+// UnsubscribeURL is the link which turns off the recipient's digests.
+func (d digestEmail) UnsubscribeURL() string {
+	return d.Unsubscribe
+}
+
+// Expires is when the unsubscribe link stops working.
+func (d digestEmail) Expires() time.Time {
+	return d.Expiry
+}
+
+// Frequency names how often the digest is sent.
+func (d digestEmail) Frequency() string {
+	if d.Digest.Frequency == models.DigestWeekly {
+		return "weekly"
+	}
+	return "daily"
+}
+
+// sendDigests periodically sends every digest which is due. Sent digests are
+// recorded in the database, so restarting the server never sends one twice.
+// It runs until the context is canceled.
+func (app *application) sendDigests(ctx context.Context) {
+	ticker := time.NewTicker(digestInterval)
+	defer ticker.Stop()
+	for {
+		usernames, err := app.digests.Due(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			app.errLog.Println("failed finding due digests:", err)
+		}
+		for _, username := range usernames {
+			err := app.sendDigest(ctx, username)
+			if err != nil && ctx.Err() == nil {
+				app.errLog.Println("failed sending digest:", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDigest sends a user's digest if it is still due and has anything in it.
+func (app *application) sendDigest(ctx context.Context, username string) error {
+	digest, err := app.digests.Claim(ctx, username, time.Now())
+	if errors.Is(err, models.ErrNoRecord) {
+		return nil // Already sent by someone else.
+	} else if err != nil {
+		return err
+	}
+	if digest.Empty() {
+		return nil
+	}
+
+	token, err := app.digests.NewUnsubscribeToken(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	return app.mailer.Send(ctx, digest.Email, "digest", digestEmail{
+		Digest: digest,
+		Unsubscribe: app.baseURL + "/digest/unsubscribe?token=" +
+			url.QueryEscape(token),
+		Expiry: time.Now().Add(models.UnsubscribeTTL),
+	})
+}
+
+type digestUnsubscribePage struct {
+	Page
+	Token string
+}
+
+// digestUnsubscribeHandler asks a user to confirm they want to stop getting
+// digests. Following a link must not unsubscribe by itself since mail scanners
+// open every link in an email.
+func (app *application) digestUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	app.render(w, http.StatusOK, "digestUnsubscribe.tmpl", digestUnsubscribePage{
+		Page: app.newPage(
+			r,
+			"Unsubscribe - Kudoer",
+			"Stop getting email digests from Kudoer.",
+		),
+		Token: r.URL.Query().Get("token"),
+	})
+}
+
+// digestUnsubscribePostHandler turns off digests for the owner of an
+// unsubscribe token. The token proves the request came from the digest, so
+// mail clients can also post here directly.
+func (app *application) digestUnsubscribePostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Mail clients send the token in the URL used for one-click unsubscribe.
+	token := r.PostForm.Get("token")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+
+	_, err = app.digests.Unsubscribe(r.Context(), token)
+	if errors.Is(err, models.ErrUnsubscribeTokenInvalid) {
+		app.flash(r, "That unsubscribe link has expired. You can turn off digests in your settings.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.flash(r, "You won't get any more digests")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
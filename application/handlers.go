@@ -25,7 +25,11 @@ func (app *application) Routes() http.Handler {
 	}
 	mux.Handle("GET /robots.txt", http.FileServerFS(subFS))
 
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf)
+	dynamic := alice.New(
+		app.sessionClient,
+		app.sessionManager.LoadAndSave,
+		noSurf,
+	)
 
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.homeHandler))
 	mux.Handle("GET /all", dynamic.ThenFunc(app.allHandler))
@@ -37,22 +41,62 @@ func (app *application) Routes() http.Handler {
 	mux.Handle("POST /user/register", dynamic.ThenFunc(app.userRegisterPostHandler))
 	mux.Handle("GET /user/login", dynamic.ThenFunc(app.userLoginHandler))
 	mux.Handle("POST /user/login", dynamic.ThenFunc(app.userLoginPostHandler))
+	mux.Handle("POST /user/login/passkey", dynamic.ThenFunc(app.userLoginPasskeyPostHandler))
+	mux.Handle("GET /user/login/2fa", dynamic.ThenFunc(app.loginTwoFactorHandler))
+	mux.Handle("POST /user/login/2fa", dynamic.ThenFunc(app.loginTwoFactorPostHandler))
 	mux.Handle("GET /user/forgot", dynamic.ThenFunc(app.userForgotHandler))
 	mux.Handle("POST /user/forgot", dynamic.ThenFunc(app.userForgotPostHandler))
 	mux.Handle("GET /user/reset", dynamic.ThenFunc(app.userResetHandler))
 	mux.Handle("POST /user/reset", dynamic.ThenFunc(app.userResetPostHandler))
+	mux.Handle("GET /items", dynamic.ThenFunc(app.itemsHandler))
 	mux.Handle("GET /item/view/{id}", dynamic.ThenFunc(app.itemViewHandler))
+	mux.Handle("GET /item/history/{id}", dynamic.ThenFunc(app.itemHistoryHandler))
+	mux.Handle("GET /item/timeline/{id}/{username}", dynamic.ThenFunc(app.itemTimelineHandler))
+	mux.Handle("GET /kudo/view/{id}", dynamic.ThenFunc(app.kudoViewHandler))
+	mux.Handle("GET /kudo/history/{id}", dynamic.ThenFunc(app.kudoHistoryHandler))
+	mux.Handle("GET /user/verify", dynamic.ThenFunc(app.userVerifyHandler))
+	mux.Handle("POST /user/verify", dynamic.ThenFunc(app.userVerifyPostHandler))
+	mux.Handle("GET /digest/unsubscribe", dynamic.ThenFunc(app.digestUnsubscribeHandler))
+
+	// Requests carrying a secret token from an email need no CSRF token.
+	emailed := alice.New(app.sessionClient, app.sessionManager.LoadAndSave)
+	mux.Handle("POST /digest/unsubscribe", emailed.ThenFunc(app.digestUnsubscribePostHandler))
 
 	protected := dynamic.Append(app.requireAuthentication)
 
 	mux.Handle("POST /user/logout", protected.ThenFunc(app.userLogoutPostHandler))
 	mux.Handle("GET /user/settings", protected.ThenFunc(app.userSettingsHandler))
 	mux.Handle("POST /user/settings", protected.ThenFunc(app.userSettingsPostHandler))
+	mux.Handle("GET /user/2fa", protected.ThenFunc(app.twoFactorHandler))
+	mux.Handle("POST /user/2fa/enable", protected.ThenFunc(app.twoFactorEnablePostHandler))
+	mux.Handle("POST /user/2fa/disable", protected.ThenFunc(app.twoFactorDisablePostHandler))
+	mux.Handle("POST /user/2fa/recovery", protected.ThenFunc(app.twoFactorRecoveryPostHandler))
+	mux.Handle("GET /user/sessions", protected.ThenFunc(app.userSessionsHandler))
+	mux.Handle("POST /user/sessions/revoke", protected.ThenFunc(app.userSessionsRevokePostHandler))
+	mux.Handle("GET /user/passkeys", protected.ThenFunc(app.passkeysHandler))
+	mux.Handle("POST /user/passkeys", protected.ThenFunc(app.passkeysPostHandler))
+	mux.Handle("POST /user/passkeys/delete", protected.ThenFunc(app.passkeysDeletePostHandler))
+	mux.Handle("POST /user/verify/resend", protected.ThenFunc(app.userVerifyResendPostHandler))
 	mux.Handle("POST /user/follow", protected.ThenFunc(app.userFollowPostHandler))
 	mux.Handle("POST /user/unfollow", protected.ThenFunc(app.userUnfollowPostHandler))
+	mux.Handle("GET /notifications", protected.ThenFunc(app.notificationsHandler))
+	mux.Handle("POST /notifications/read", protected.ThenFunc(app.notificationsReadPostHandler))
+	mux.Handle("GET /admin/outbox", protected.ThenFunc(app.adminOutboxHandler))
+	mux.Handle("POST /admin/outbox", protected.ThenFunc(app.adminOutboxPostHandler))
+	mux.Handle("GET /admin/lockouts", protected.ThenFunc(app.adminLockoutsHandler))
+	mux.Handle("POST /admin/lockouts", protected.ThenFunc(app.adminLockoutsPostHandler))
 	mux.Handle("GET /item/create", protected.ThenFunc(app.itemCreateHandler))
 	mux.Handle("POST /item/create", protected.ThenFunc(app.itemCreatePostHandler))
+	mux.Handle("GET /item/edit/{id}", protected.ThenFunc(app.itemEditHandler))
+	mux.Handle("POST /item/edit/{id}", protected.ThenFunc(app.itemEditPostHandler))
+	mux.Handle("POST /item/revert/{id}", protected.ThenFunc(app.itemRevertPostHandler))
+	mux.Handle("GET /item/merge/{id}", protected.ThenFunc(app.itemMergeHandler))
+	mux.Handle("POST /item/merge/{id}", protected.ThenFunc(app.itemMergePostHandler))
 	mux.Handle("POST /kudo/{id}", protected.ThenFunc(app.kudoPostHandler))
+	mux.Handle("POST /kudo/{id}/delete", protected.ThenFunc(app.kudoDeletePostHandler))
+	mux.Handle("POST /kudo/{id}/restore", protected.ThenFunc(app.kudoRestorePostHandler))
+	mux.Handle("POST /kudo/{id}/reply", protected.ThenFunc(app.kudoReplyPostHandler))
+	mux.Handle("POST /reply/{id}/delete", protected.ThenFunc(app.replyDeletePostHandler))
 
 	standard := alice.New(
 		app.recoverPanic,
@@ -5,9 +5,12 @@ package application
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -36,6 +39,53 @@ func (app *application) authenticated(r *http.Request) string {
 	return app.sessionManager.GetString(r.Context(), "authenticatedUsername")
 }
 
+// isAdmin reports if the given user is allowed to moderate the site.
+func (app *application) isAdmin(username string) bool {
+	return username != "" && slices.Contains(app.admins, username)
+}
+
+// clientIP returns the address of the client making a request. The
+// X-Forwarded-For header is only believed when the request came from a trusted
+// proxy, and then the last address in it which isn't a trusted proxy is used
+// since anything before it could be made up by the client.
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !app.trustedProxy(ip) {
+		return ip
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !app.trustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// trustedProxy reports if an address belongs to a trusted proxy.
+func (app *application) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 // page checks for the page URL parameter and returns a valid page number.
 func page(params url.Values) int {
 	if ok := params.Has("page"); ok {
@@ -47,6 +97,22 @@ func page(params url.Values) int {
 	return 1
 }
 
+// excerpt shortens text to at most n characters, cutting it at a word boundary
+// when possible.
+func excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+
+	cut := string(runes[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
 // destroySessions will remove every session for a given username.
 // This logs the user out on all of their computers.
 func (app *application) destroySessions(username string) error {
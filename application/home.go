@@ -33,7 +33,7 @@ func (app *application) homeHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		var err error
-		kudos, err = app.kudos.All(r.Context(), page)
+		kudos, err = app.kudos.All(r.Context(), username, page)
 		if err != nil {
 			app.serverError(w, err)
 			return
@@ -54,7 +54,7 @@ func (app *application) allHandler(w http.ResponseWriter, r *http.Request) {
 	params := r.URL.Query()
 	page := page(params)
 
-	kudos, err := app.kudos.All(r.Context(), page)
+	kudos, err := app.kudos.All(r.Context(), app.authenticated(r), page)
 	if err != nil {
 		app.serverError(w, err)
 		return
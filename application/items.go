@@ -3,13 +3,21 @@
 package application
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"image"
+	"maps"
 	"math/rand"
 	"net/http"
+	"path"
+	"strings"
 
+	"git.sr.ht/~kota/kudoer/application/diff"
 	"git.sr.ht/~kota/kudoer/application/emoji"
 	"git.sr.ht/~kota/kudoer/application/frames"
+	"git.sr.ht/~kota/kudoer/application/kinds"
+	"git.sr.ht/~kota/kudoer/application/media"
 	"git.sr.ht/~kota/kudoer/application/validator"
 	"git.sr.ht/~kota/kudoer/db/models"
 	"github.com/oklog/ulid"
@@ -21,11 +29,15 @@ type itemViewPage struct {
 	PageSize   int
 
 	models.Item
+	KindInfo kinds.Kind
 
 	Emojis []emoji.Emoji
 
 	CreatorPic string
 
+	// Filename of the item's large cover image, if it has one.
+	Cover string
+
 	// Random default frame for the user.
 	Frame      int
 	FrameCount int
@@ -33,6 +45,18 @@ type itemViewPage struct {
 	// Has the user already given kudos for this item?
 	Kudoed bool
 
+	// ID of the user's newest kudo for this item, if they've given one.
+	KudoID string
+
+	// Who may see the user's newest kudo, preselected in the kudo form.
+	Visibility models.Visibility
+
+	// May the user record another kudo for an item they've already kudoed?
+	AllowRevisits bool
+
+	// Is the user allowed to merge this item into another?
+	CanMerge bool
+
 	// All kudos given to this item.
 	Kudos []models.Kudo
 }
@@ -50,25 +74,48 @@ func (app *application) itemViewHandler(w http.ResponseWriter, r *http.Request)
 
 	item, err := app.items.Info(r.Context(), uuid)
 	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			http.NotFound(w, r)
-		} else {
+		if !errors.Is(err, models.ErrNoRecord) {
 			app.serverError(w, err)
+			return
+		}
+
+		// The item may have been merged into another item.
+		target, err := app.items.Redirect(r.Context(), uuid)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				http.NotFound(w, r)
+			} else {
+				app.serverError(w, err)
+			}
+			return
 		}
+		http.Redirect(
+			w,
+			r,
+			fmt.Sprintf("/item/view/%v", target),
+			http.StatusMovedPermanently,
+		)
 		return
 	}
 
-	kudos, err := app.kudos.Item(r.Context(), uuid, page)
+	username := app.authenticated(r)
+	kudos, err := app.kudos.Item(r.Context(), uuid, username, page)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
 	var kudoed bool
+	var kudoID string
+	var visibility models.Visibility
 	var creatorPic string
-	if username := app.authenticated(r); username != "" {
-		if _, err := app.kudos.ItemUser(r.Context(), uuid, username); errors.Is(err, models.ErrNoRecord) {
+	if username != "" {
+		k, err := app.kudos.ItemUser(r.Context(), uuid, username, username)
+		if errors.Is(err, models.ErrNoRecord) {
 			kudoed = true
+		} else if err == nil {
+			kudoID = k.ID.String()
+			visibility = k.Visibility
 		}
 
 		if pics, err := app.profilepics.Get(r.Context(), username); err == nil {
@@ -76,37 +123,63 @@ func (app *application) itemViewHandler(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	covers, err := app.itemImages.Get(r.Context(), uuid)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	title := item.Name + " - " + "Kudoer"
 	app.render(w, http.StatusOK, "itemView.tmpl", itemViewPage{
-		Page:       app.newPage(r, title, item.Description),
-		PageNumber: page,
-		PageSize:   models.PageSize,
-		Item:       item,
-		Emojis:     emoji.Shuffle(),
-		CreatorPic: creatorPic,
-		Frame:      rand.Intn(frames.Count),
-		FrameCount: frames.Count,
-		Kudoed:     kudoed,
-		Kudos:      kudos,
+		Page:          app.newPage(r, title, item.Description),
+		PageNumber:    page,
+		PageSize:      models.PageSize,
+		Item:          item,
+		KindInfo:      kinds.Get(item.Kind),
+		Emojis:        emoji.Shuffle(),
+		CreatorPic:    creatorPic,
+		Cover:         covers[models.ItemCoverJPEG600],
+		Frame:         rand.Intn(frames.Count),
+		FrameCount:    frames.Count,
+		Kudoed:        kudoed,
+		KudoID:        kudoID,
+		Visibility:    visibility,
+		AllowRevisits: app.allowRevisits,
+		CanMerge:      app.canMerge(r, item),
+		Kudos:         kudos,
 	})
 }
 
 type itemCreatePage struct {
 	Page
-	Form itemCreateForm
+	Kinds    []kinds.Kind
+	KindInfo kinds.Kind
+	Form     itemCreateForm
 }
 
 // itemCreateHandler presents a web form to add an item.
+// The kind URL parameter selects which attribute fields are shown.
 func (app *application) itemCreateHandler(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("kind")
+	if !kinds.Validate(kind) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
 	app.render(w, http.StatusOK, "itemCreate.tmpl", itemCreatePage{
-		Page: app.newPage(r, "Create an item", "Create a new item on Kudoer"),
-		Form: itemCreateForm{},
+		Page:     app.newPage(r, "Create an item", "Create a new item on Kudoer"),
+		Kinds:    kinds.All(),
+		KindInfo: kinds.Get(kind),
+		Form:     itemCreateForm{Kind: kind},
 	})
 }
 
 type itemCreateForm struct {
 	Name        string
 	Description string
+	Source      string
+	Kind        string
+	Attributes  map[string]string
 
 	// FieldErrors stores errors relating to specific form fields.
 	FieldErrors map[string]string
@@ -114,9 +187,8 @@ type itemCreateForm struct {
 
 // itemCreatePostHandler adds an item.
 func (app *application) itemCreatePostHandler(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, 4096)
-	err := r.ParseForm()
-	if err != nil {
+	err := r.ParseMultipartForm(1024 * 1024 * 5) // Ram cap, not total.
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
@@ -124,19 +196,54 @@ func (app *application) itemCreatePostHandler(w http.ResponseWriter, r *http.Req
 	form := itemCreateForm{
 		Name:        r.PostForm.Get("name"),
 		Description: r.PostForm.Get("description"),
+		Source:      strings.TrimSpace(r.PostForm.Get("source")),
+		Kind:        r.PostForm.Get("kind"),
 		FieldErrors: map[string]string{},
 	}
 
 	v := validator.New()
 	v.ItemName(form.Name)
 	v.ItemDescription(form.Description)
+	if form.Source != "" {
+		form.Source = v.Source(form.Source)
+	}
+	v.ItemKind(form.Kind)
+	form.Attributes = v.ItemAttributes(form.Kind, attributesForm(r, form.Kind))
 
-	var valid bool
-	if _, form.FieldErrors, valid = v.Valid(); !valid {
+	validationError := func() {
 		app.render(w, http.StatusUnprocessableEntity, "itemCreate.tmpl", itemCreatePage{
-			Page: app.newPage(r, "Create an item", "Create a new item on Kudoer"),
-			Form: form,
+			Page:     app.newPage(r, "Create an item", "Create a new item on Kudoer"),
+			Kinds:    kinds.All(),
+			KindInfo: kinds.Get(form.Kind),
+			Form:     form,
 		})
+	}
+	var valid bool
+	if _, form.FieldErrors, valid = v.Valid(); !valid {
+		validationError()
+		return
+	}
+
+	// Send the user to the existing item rather than creating a duplicate.
+	if form.Source != "" {
+		id, err := app.items.FindSource(r.Context(), form.Source)
+		if err == nil {
+			app.flash(r, "That item already exists")
+			http.Redirect(w, r, fmt.Sprintf("/item/view/%v", id), http.StatusSeeOther)
+			return
+		} else if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	cover, err := app.readCover(r, v)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if _, form.FieldErrors, valid = v.Valid(); !valid {
+		validationError()
 		return
 	}
 
@@ -146,12 +253,643 @@ func (app *application) itemCreatePostHandler(w http.ResponseWriter, r *http.Req
 		username,
 		form.Name,
 		form.Description,
+		form.Source,
+		form.Kind,
+		form.Attributes,
 	)
-	if err != nil {
+	if errors.Is(err, models.ErrSourceExists) {
+		v.AddFieldError("source", "Another item already uses this source")
+		_, form.FieldErrors, _ = v.Valid()
+		validationError()
+		return
+	} else if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	if cover != nil {
+		err = app.storeCover(r.Context(), id, cover)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
 	app.flash(r, "Item created")
 	http.Redirect(w, r, fmt.Sprintf("/item/view/%v", id), http.StatusSeeOther)
 }
+
+// readCover decodes the cover image uploaded with an item form, if there is
+// one. Problems with the upload itself are added to the validator as field
+// errors. Nothing is stored until storeCover is called so a form which fails
+// doesn't leave images behind.
+func (app *application) readCover(
+	r *http.Request,
+	v *validator.Validator,
+) (image.Image, error) {
+	file, fileHeader, err := r.FormFile("cover")
+	if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if fileHeader.Size > (1024 * 1024 * 50) {
+		v.AddFieldError("cover", "Cover image must be less than 50MB")
+		return nil, nil
+	}
+
+	cover, err := media.DecodeCover(file)
+	if errors.Is(err, media.ErrDecode) {
+		v.AddFieldError("cover", "Cover image must be a PNG or JPEG")
+		return nil, nil
+	}
+	return cover, err
+}
+
+// storeCover stores a cover image read by readCover and sets it as an item's
+// cover.
+func (app *application) storeCover(
+	ctx context.Context,
+	itemID ulid.ULID,
+	cover image.Image,
+) error {
+	cover600, cover150, err := app.mediaStore.StoreCover(cover)
+	if err != nil {
+		return err
+	}
+	return app.itemImages.Set(ctx, itemID, cover600, cover150)
+}
+
+// attributesForm reads the attribute fields for a kind of item from a parsed
+// form.
+func attributesForm(r *http.Request, kind string) map[string]string {
+	attrs := make(map[string]string)
+	for _, a := range kinds.Get(kind).Attributes {
+		attrs[a.Key] = r.PostForm.Get("attr-" + a.Key)
+	}
+	return attrs
+}
+
+// attributesText presents an item's kind and attributes as lines of text so
+// they can be compared between revisions.
+func attributesText(kind string, attrs map[string]string) string {
+	k := kinds.Get(kind)
+	if k.Key == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Kind: " + k.Name)
+	for _, a := range k.Attributes {
+		if value := attrs[a.Key]; value != "" {
+			b.WriteString("\n" + a.Label + ": " + value)
+		}
+	}
+	return b.String()
+}
+
+type itemEditPage struct {
+	Page
+	ID       ulid.ULID
+	Kinds    []kinds.Kind
+	KindInfo kinds.Kind
+	Form     itemEditForm
+}
+
+type itemEditForm struct {
+	Name        string
+	Description string
+	Source      string
+	Kind        string
+	Attributes  map[string]string
+
+	// FieldErrors stores errors relating to specific form fields.
+	FieldErrors map[string]string
+}
+
+// itemEditHandler presents a web form to edit an item.
+func (app *application) itemEditHandler(w http.ResponseWriter, r *http.Request) {
+	uuid, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	item, err := app.items.Info(r.Context(), uuid)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// The kind URL parameter allows switching the item to a different kind.
+	params := r.URL.Query()
+	kind := item.Kind
+	if params.Has("kind") {
+		kind = params.Get("kind")
+		if !kinds.Validate(kind) {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	app.render(w, http.StatusOK, "itemEdit.tmpl", itemEditPage{
+		Page:     app.newPage(r, "Editing "+item.Name, "Edit an item on Kudoer"),
+		ID:       item.ID,
+		Kinds:    kinds.All(),
+		KindInfo: kinds.Get(kind),
+		Form: itemEditForm{
+			Name:        item.Name,
+			Description: item.Description,
+			Source:      item.Source,
+			Kind:        kind,
+			Attributes:  item.Attributes,
+		},
+	})
+}
+
+// itemEditPostHandler updates an item and records the edit as a revision.
+func (app *application) itemEditPostHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(1024 * 1024 * 5) // Ram cap, not total.
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	uuid, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	item, err := app.items.Info(r.Context(), uuid)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	form := itemEditForm{
+		Name:        r.PostForm.Get("name"),
+		Description: r.PostForm.Get("description"),
+		Source:      strings.TrimSpace(r.PostForm.Get("source")),
+		Kind:        r.PostForm.Get("kind"),
+		FieldErrors: map[string]string{},
+	}
+
+	v := validator.New()
+	v.ItemName(form.Name)
+	v.ItemDescription(form.Description)
+	if form.Source != "" {
+		form.Source = v.Source(form.Source)
+	}
+	v.ItemKind(form.Kind)
+	form.Attributes = v.ItemAttributes(form.Kind, attributesForm(r, form.Kind))
+
+	validationError := func() {
+		app.render(w, http.StatusUnprocessableEntity, "itemEdit.tmpl", itemEditPage{
+			Page:     app.newPage(r, "Editing "+item.Name, "Edit an item on Kudoer"),
+			ID:       item.ID,
+			Kinds:    kinds.All(),
+			KindInfo: kinds.Get(form.Kind),
+			Form:     form,
+		})
+	}
+	var valid bool
+	if _, form.FieldErrors, valid = v.Valid(); !valid {
+		validationError()
+		return
+	}
+
+	cover, err := app.readCover(r, v)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if _, form.FieldErrors, valid = v.Valid(); !valid {
+		validationError()
+		return
+	}
+
+	// The cover image isn't part of an item's revisions so changing only the
+	// cover doesn't record a new revision.
+	changed := form.Name != item.Name ||
+		form.Description != item.Description ||
+		form.Source != item.Source ||
+		form.Kind != item.Kind ||
+		!maps.Equal(form.Attributes, item.Attributes)
+	if !changed && cover == nil {
+		app.flash(r, "No changes were made")
+		http.Redirect(w, r, fmt.Sprintf("/item/view/%v", uuid), http.StatusSeeOther)
+		return
+	}
+
+	if changed {
+		err = app.items.Update(
+			r.Context(),
+			uuid,
+			app.authenticated(r),
+			form.Name,
+			form.Description,
+			form.Source,
+			form.Kind,
+			form.Attributes,
+		)
+		if errors.Is(err, models.ErrSourceExists) {
+			v.AddFieldError("source", "Another item already uses this source")
+			_, form.FieldErrors, _ = v.Valid()
+			validationError()
+			return
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	if cover != nil {
+		err = app.storeCover(r.Context(), uuid, cover)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	app.flash(r, "Item updated")
+	http.Redirect(w, r, fmt.Sprintf("/item/view/%v", uuid), http.StatusSeeOther)
+}
+
+type itemHistoryPage struct {
+	Page
+	models.Item
+
+	// Every revision of the item from newest to oldest.
+	Revisions []itemRevision
+}
+
+// itemRevision is an item revision along with the changes it made compared to
+// the revision before it.
+type itemRevision struct {
+	models.ItemRevision
+
+	// Is this the item's current revision?
+	Current bool
+
+	NameDiff        []diff.Segment
+	DescriptionDiff []diff.Segment
+	SourceDiff      []diff.Segment
+	AttributesDiff  []diff.Segment
+}
+
+type itemTimelinePage struct {
+	Page
+	models.Item
+	User models.User
+
+	// Every kudo the user gave to the item from newest to oldest.
+	Kudos []models.Kudo
+}
+
+// itemTimelineHandler presents every kudo one user has given to an item.
+func (app *application) itemTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	uuid, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	item, err := app.items.Info(r.Context(), uuid)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	user, err := app.users.Info(r.Context(), r.PathValue("username"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	kudos, err := app.kudos.Timeline(r.Context(), uuid, user.Username, app.authenticated(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	title := fmt.Sprintf("%v's kudos for %v", user.DisplayName, item.Name)
+	app.render(w, http.StatusOK, "itemTimeline.tmpl", itemTimelinePage{
+		Page:  app.newPage(r, title+" - Kudoer", "Every visit to "+item.Name),
+		Item:  item,
+		User:  user,
+		Kudos: kudos,
+	})
+}
+
+// itemHistoryHandler presents every revision of an item.
+func (app *application) itemHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	uuid, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	item, err := app.items.Info(r.Context(), uuid)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	revisions, err := app.items.Revisions(r.Context(), uuid)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	history := make([]itemRevision, len(revisions))
+	for i, rev := range revisions {
+		// Revisions are newest first so the previous one follows.
+		var prev models.ItemRevision
+		if i+1 < len(revisions) {
+			prev = revisions[i+1]
+		}
+		history[i] = itemRevision{
+			ItemRevision:    rev,
+			Current:         i == 0,
+			NameDiff:        diff.Words(prev.Name, rev.Name),
+			DescriptionDiff: diff.Words(prev.Description, rev.Description),
+			SourceDiff:      diff.Words(prev.Source, rev.Source),
+			AttributesDiff: diff.Words(
+				attributesText(prev.Kind, prev.Attributes),
+				attributesText(rev.Kind, rev.Attributes),
+			),
+		}
+	}
+
+	title := item.Name + " History - Kudoer"
+	desc := "Edit history of " + item.Name + " on Kudoer"
+	app.render(w, http.StatusOK, "itemHistory.tmpl", itemHistoryPage{
+		Page:      app.newPage(r, title, desc),
+		Item:      item,
+		Revisions: history,
+	})
+}
+
+// itemRevertPostHandler restores an item to a previous revision.
+// The revert is itself recorded as a new revision.
+func (app *application) itemRevertPostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	uuid, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	revisionID, err := ulid.Parse(r.PostForm.Get("revision"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	rev, err := app.items.Revision(r.Context(), revisionID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	if rev.ItemID.Compare(uuid) != 0 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.items.Update(
+		r.Context(),
+		uuid,
+		app.authenticated(r),
+		rev.Name,
+		rev.Description,
+		rev.Source,
+		rev.Kind,
+		rev.Attributes,
+	)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else if errors.Is(err, models.ErrSourceExists) {
+			app.flash(r, "Another item now uses this revision's source")
+			http.Redirect(w, r, fmt.Sprintf("/item/history/%v", uuid), http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.flash(r, "Item reverted")
+	http.Redirect(w, r, fmt.Sprintf("/item/history/%v", uuid), http.StatusSeeOther)
+}
+
+// canMerge reports if the current user may merge an item into another.
+// Only the item's creator and admins can merge an item.
+func (app *application) canMerge(r *http.Request, item models.Item) bool {
+	username := app.authenticated(r)
+	if username == "" {
+		return false
+	}
+	return username == item.CreatorUsername || app.isAdmin(username)
+}
+
+type itemMergePage struct {
+	Page
+	models.Item
+	Form itemMergeForm
+}
+
+type itemMergeForm struct {
+	Into string
+
+	// FieldErrors stores errors relating to specific form fields.
+	FieldErrors map[string]string
+}
+
+// itemMergeHandler presents a web form to merge a duplicate item into another.
+func (app *application) itemMergeHandler(w http.ResponseWriter, r *http.Request) {
+	uuid, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	item, err := app.items.Info(r.Context(), uuid)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if !app.canMerge(r, item) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	app.render(w, http.StatusOK, "itemMerge.tmpl", itemMergePage{
+		Page: app.newPage(r, "Merging "+item.Name, "Merge a duplicate item on Kudoer"),
+		Item: item,
+		Form: itemMergeForm{},
+	})
+}
+
+// itemMergePostHandler merges a duplicate item into another.
+func (app *application) itemMergePostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	uuid, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	item, err := app.items.Info(r.Context(), uuid)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if !app.canMerge(r, item) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	form := itemMergeForm{
+		Into:        strings.TrimSpace(r.PostForm.Get("into")),
+		FieldErrors: map[string]string{},
+	}
+
+	v := validator.New()
+
+	// Accept either an item ID or a link to the item's page.
+	into, err := ulid.Parse(path.Base(form.Into))
+	if err != nil {
+		v.AddFieldError("into", "Must be an item ID or a link to an item")
+	} else if into.Compare(uuid) == 0 {
+		v.AddFieldError("into", "An item cannot be merged into itself")
+	} else if _, err := app.items.Info(r.Context(), into); err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+		v.AddFieldError("into", "Item does not exist")
+	}
+
+	var valid bool
+	if _, form.FieldErrors, valid = v.Valid(); !valid {
+		app.render(w, http.StatusUnprocessableEntity, "itemMerge.tmpl", itemMergePage{
+			Page: app.newPage(r, "Merging "+item.Name, "Merge a duplicate item on Kudoer"),
+			Item: item,
+			Form: form,
+		})
+		return
+	}
+
+	err = app.items.Merge(
+		r.Context(),
+		uuid,
+		into,
+		app.authenticated(r),
+		app.allowRevisits,
+	)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.flash(r, "Items merged")
+	http.Redirect(w, r, fmt.Sprintf("/item/view/%v", into), http.StatusSeeOther)
+}
+
+type itemsPage struct {
+	Page
+	PageNumber int
+	PageSize   int
+
+	Kinds []kinds.Kind
+	Kind  string
+
+	Items []models.Item
+}
+
+// itemsHandler presents a list of items.
+// The kind URL parameter limits the list to items of that kind.
+func (app *application) itemsHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	page := page(params)
+
+	kind := params.Get("kind")
+	if !kinds.Validate(kind) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	items, err := app.items.List(r.Context(), kind, app.authenticated(r), page)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	title := "Items - Kudoer"
+	desc := "Browse items on Kudoer"
+	if name := kinds.Name(kind); name != "" {
+		title = name + " " + title
+		desc = "Browse " + strings.ToLower(name) + " items on Kudoer"
+	}
+	app.render(w, http.StatusOK, "items.tmpl", itemsPage{
+		Page:       app.newPage(r, title, desc),
+		PageNumber: page,
+		PageSize:   models.PageSize,
+		Kinds:      kinds.All(),
+		Kind:       kind,
+		Items:      items,
+	})
+}
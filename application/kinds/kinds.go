@@ -0,0 +1,113 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package kinds
+
+// AttributeType describes what sort of value an attribute holds. It is used to
+// pick how the attribute is validated and presented in forms.
+type AttributeType int
+
+const (
+	Text AttributeType = iota
+	Year
+	ISBN
+)
+
+// Attribute is a typed piece of information belonging to a kind of item. The
+// Key is used in the forms and stored in our database. Label is shown to
+// users.
+type Attribute struct {
+	Key   string
+	Label string
+	Type  AttributeType
+}
+
+// IsYear reports if the attribute holds a year.
+func (a Attribute) IsYear() bool {
+	return a.Type == Year
+}
+
+// Kind represents a kind of item such as a book or a film. The Key is stored in
+// our database and used in URLs. An item with a blank kind has no attributes.
+type Kind struct {
+	Key        string
+	Name       string
+	Attributes []Attribute
+}
+
+var all = []Kind{
+	{
+		Key:  "book",
+		Name: "Book",
+		Attributes: []Attribute{
+			{Key: "author", Label: "Author", Type: Text},
+			{Key: "isbn", Label: "ISBN", Type: ISBN},
+			{Key: "year", Label: "Year", Type: Year},
+		},
+	},
+	{
+		Key:  "film",
+		Name: "Film",
+		Attributes: []Attribute{
+			{Key: "director", Label: "Director", Type: Text},
+			{Key: "year", Label: "Year", Type: Year},
+		},
+	},
+	{
+		Key:  "album",
+		Name: "Album",
+		Attributes: []Attribute{
+			{Key: "artist", Label: "Artist", Type: Text},
+			{Key: "year", Label: "Year", Type: Year},
+		},
+	},
+	{
+		Key:  "place",
+		Name: "Place",
+		Attributes: []Attribute{
+			{Key: "address", Label: "Address", Type: Text},
+		},
+	},
+	{
+		Key:  "game",
+		Name: "Game",
+		Attributes: []Attribute{
+			{Key: "developer", Label: "Developer", Type: Text},
+			{Key: "year", Label: "Year", Type: Year},
+		},
+	},
+}
+
+// All returns every kind of item.
+func All() []Kind {
+	return all
+}
+
+// Get returns the kind for a given key.
+// The blank key returns an empty Kind without any attributes.
+func Get(key string) Kind {
+	for _, k := range all {
+		if k.Key == key {
+			return k
+		}
+	}
+	return Kind{}
+}
+
+// Validate returns true if a given kind key is valid.
+// The blank key is valid and represents an item without a kind.
+func Validate(key string) bool {
+	if key == "" {
+		return true
+	}
+	for _, k := range all {
+		if k.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the display name for a given kind key.
+func Name(key string) string {
+	return Get(key).Name
+}
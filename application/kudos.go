@@ -3,16 +3,21 @@
 package application
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"git.sr.ht/~kota/kudoer/application/diff"
 	"git.sr.ht/~kota/kudoer/application/validator"
 	"git.sr.ht/~kota/kudoer/db/models"
 	"github.com/oklog/ulid"
 )
 
-// kudoPostHandler creates a kudo.
+// kudoPostHandler creates a kudo or updates the user's newest kudo for the
+// item. When revisits are allowed the "revisit" action records a new kudo
+// instead.
 func (app *application) kudoPostHandler(w http.ResponseWriter, r *http.Request) {
 	username := app.authenticated(r)
 	r.Body = http.MaxBytesReader(w, r.Body, 4096)
@@ -29,11 +34,13 @@ func (app *application) kudoPostHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	v := validator.New()
-	e, f, body := v.Kudo(
+	e, f, body, warning := v.Kudo(
 		r.PostForm.Get("emoji"),
 		r.PostForm.Get("frame"),
 		r.PostForm.Get("body"),
+		r.PostForm.Get("warning"),
 	)
+	visibility := models.Visibility(v.Visibility(r.PostForm.Get("visibility")))
 
 	_, fieldErrors, valid := v.Valid()
 	if !valid {
@@ -46,35 +53,49 @@ func (app *application) kudoPostHandler(w http.ResponseWriter, r *http.Request)
 		r.Context(),
 		itemID,
 		username,
+		username,
 	)
-	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			if _, err := app.kudos.Insert(
-				r.Context(),
-				itemID,
-				username,
-				f,
-				e,
-				body,
-			); err != nil {
-				app.serverError(w, err)
-				return
-			}
-			app.flash(r, "Kudos given")
-		} else {
+	revisit := app.allowRevisits && r.PostForm.Get("action") == "revisit"
+	if errors.Is(err, models.ErrNoRecord) || (err == nil && revisit) {
+		if _, err := app.kudos.Insert(
+			r.Context(),
+			itemID,
+			username,
+			f,
+			e,
+			body,
+			warning,
+			visibility,
+			validator.Mentions(body),
+		); err != nil {
 			app.serverError(w, err)
 			return
 		}
+		app.flash(r, "Kudos given")
+		http.Redirect(w, r, fmt.Sprintf("/item/view/%v", itemID), http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if k.Frame == f && k.Emoji == e && k.Body == body &&
+		k.Warning == warning && k.Visibility == visibility {
+		app.flash(r, "No changes were made")
+		http.Redirect(w, r, fmt.Sprintf("/item/view/%v", itemID), http.StatusSeeOther)
+		return
 	}
 
 	if err := app.kudos.Update(
 		r.Context(),
 		k.ID,
-		itemID,
 		username,
 		f,
 		e,
 		body,
+		warning,
+		visibility,
+		validator.Mentions(body),
 	); err != nil {
 		app.serverError(w, err)
 		return
@@ -82,3 +103,318 @@ func (app *application) kudoPostHandler(w http.ResponseWriter, r *http.Request)
 	app.flash(r, "Kudos updated")
 	http.Redirect(w, r, fmt.Sprintf("/item/view/%v", itemID), http.StatusSeeOther)
 }
+
+type kudoViewPage struct {
+	Page
+	Kudo models.Kudo
+	Item models.Item
+
+	// Replies to the kudo from oldest to newest.
+	Replies []replyView
+}
+
+// replyView is a reply along with what the current user may do with it.
+type replyView struct {
+	models.Reply
+	CSRFToken string
+
+	CanReply  bool
+	CanDelete bool
+
+	// Replies to this reply which are still shown.
+	Children []replyView
+}
+
+// replyViews prepares a tree of replies to a kudo for display.
+// Deleted replies are only kept while they still have replies of their own.
+func replyViews(
+	replies []*models.Reply,
+	k models.Kudo,
+	page Page,
+	depth int,
+) []replyView {
+	var views []replyView
+	for _, r := range replies {
+		children := replyViews(r.Replies, k, page, depth+1)
+		if r.Deleted && len(children) == 0 {
+			continue
+		}
+
+		username := page.Authenticated
+		views = append(views, replyView{
+			Reply:     *r,
+			CSRFToken: page.CSRFToken,
+			CanReply:  username != "" && !r.Deleted && depth < models.MaxReplyDepth,
+			CanDelete: username != "" && !r.Deleted &&
+				(username == r.CreatorUsername || username == k.CreatorUsername),
+			Children: children,
+		})
+	}
+	return views
+}
+
+// kudoViewHandler presents a single kudo along with the item it was given to.
+func (app *application) kudoViewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	k, err := app.kudos.Get(r.Context(), id, app.authenticated(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	item, err := app.items.Info(r.Context(), k.ItemID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	item.Cover = k.ItemCover
+
+	replies, err := app.kudos.Replies(r.Context(), id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	title := fmt.Sprintf("%v's kudos for %v", k.CreatorDisplayName, k.ItemName)
+	// Don't reveal what a content warning hides in link previews.
+	description := excerpt(k.Body, 160)
+	if k.Warning != "" {
+		description = "Content warning: " + k.Warning
+	}
+	page := app.newPage(r, title+" - Kudoer", description)
+	app.render(w, http.StatusOK, "kudoView.tmpl", kudoViewPage{
+		Page:    page,
+		Kudo:    k,
+		Item:    item,
+		Replies: replyViews(replies, k, page, 1),
+	})
+}
+
+// kudoReplyPostHandler adds a reply to a kudo or to another reply.
+func (app *application) kudoReplyPostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 16384)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	kudoID, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var parentID ulid.ULID
+	if parent := r.PostForm.Get("parent"); parent != "" {
+		parentID, err = ulid.Parse(parent)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	body := r.PostForm.Get("body")
+	v := validator.New()
+	v.Reply(body)
+	if _, fieldErrors, valid := v.Valid(); !valid {
+		app.flash(r, fieldErrors["reply"])
+		http.Redirect(w, r, fmt.Sprintf("/kudo/view/%v#replies", kudoID), http.StatusSeeOther)
+		return
+	}
+
+	id, err := app.kudos.InsertReply(
+		r.Context(),
+		kudoID,
+		parentID,
+		app.authenticated(r),
+		body,
+	)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else if errors.Is(err, models.ErrReplyTooDeep) {
+			app.clientError(w, http.StatusUnprocessableEntity)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.flash(r, "Reply posted")
+	http.Redirect(w, r, fmt.Sprintf("/kudo/view/%v#reply-%v", kudoID, id), http.StatusSeeOther)
+}
+
+// replyDeletePostHandler deletes a reply.
+// Replies may be deleted by their author or by the author of the kudo.
+func (app *application) replyDeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	kudoID, err := app.kudos.DeleteReply(r.Context(), id, app.authenticated(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.flash(r, "Reply deleted")
+	http.Redirect(w, r, fmt.Sprintf("/kudo/view/%v#replies", kudoID), http.StatusSeeOther)
+}
+
+type kudoHistoryPage struct {
+	Page
+	Kudo models.Kudo
+
+	// Every version of the kudo from newest to oldest.
+	Revisions []kudoRevision
+}
+
+// kudoRevision is a kudo revision along with the changes it made to the body
+// compared to the revision before it.
+type kudoRevision struct {
+	models.KudoRevision
+
+	// Is this the kudo's current revision?
+	Current bool
+
+	BodyDiff []diff.Segment
+}
+
+// kudoHistoryHandler presents every version of a kudo.
+func (app *application) kudoHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	k, err := app.kudos.Get(r.Context(), id, app.authenticated(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	revisions, err := app.kudos.Revisions(r.Context(), id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	var history []kudoRevision
+	for i, rev := range revisions {
+		// The oldest revision is compared against nothing.
+		var prev models.KudoRevision
+		if i+1 < len(revisions) {
+			prev = revisions[i+1]
+		}
+		history = append(history, kudoRevision{
+			KudoRevision: rev,
+			Current:      i == 0,
+			BodyDiff:     diff.Words(prev.Body, rev.Body),
+		})
+	}
+
+	title := fmt.Sprintf("%v's kudos for %v", k.CreatorDisplayName, k.ItemName)
+	app.render(w, http.StatusOK, "kudoHistory.tmpl", kudoHistoryPage{
+		Page:      app.newPage(r, title+" - History - Kudoer", "Every version of "+title),
+		Kudo:      k,
+		Revisions: history,
+	})
+}
+
+// undoWindow is how long a deleted kudo can be restored for.
+const undoWindow = 5 * time.Minute
+
+// kudoDeletePostHandler deletes a kudo given by the current user.
+func (app *application) kudoDeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	itemID, err := app.kudos.Delete(r.Context(), id, app.authenticated(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.flash(r, "Kudos deleted")
+	app.sessionManager.Put(r.Context(), "undoKudo", id.String())
+	http.Redirect(w, r, fmt.Sprintf("/item/view/%v", itemID), http.StatusSeeOther)
+}
+
+// kudoRestorePostHandler restores a kudo the current user recently deleted.
+func (app *application) kudoRestorePostHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := ulid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	itemID, err := app.kudos.Restore(
+		r.Context(),
+		id,
+		app.authenticated(r),
+		time.Now().Add(-undoWindow),
+		app.allowRevisits,
+	)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.flash(r, "It's too late to undo that")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrKudoExists) {
+			app.flash(r, "You've already given new kudos to this item")
+			http.Redirect(w, r, fmt.Sprintf("/item/view/%v", itemID), http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.flash(r, "Kudos restored")
+	http.Redirect(w, r, fmt.Sprintf("/item/view/%v", itemID), http.StatusSeeOther)
+}
+
+// purgeKudos periodically removes deleted kudos once they can no longer be
+// restored. It runs until the context is canceled.
+func (app *application) purgeKudos(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		err := app.kudos.Purge(ctx, time.Now().Add(-undoWindow))
+		if err != nil && ctx.Err() == nil {
+			app.errLog.Println("failed purging deleted kudos:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
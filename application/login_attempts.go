@@ -0,0 +1,271 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"git.sr.ht/~kota/kudoer/application/validator"
+	"git.sr.ht/~kota/kudoer/db/models"
+)
+
+const (
+	// loginFreeAttempts is how many logins can fail before each one
+	// delays the next.
+	loginFreeAttempts = 3
+
+	// loginMaxDelay is the longest delay between failed logins.
+	loginMaxDelay = time.Minute
+
+	// lockoutAttempts is how many failed logins lock an account. It's locked
+	// again each time that many more fail.
+	lockoutAttempts = 10
+
+	// lockoutDuration is how long a locked account can't be logged in to.
+	lockoutDuration = time.Hour
+
+	// loginFailureWindow is how long a failed login is remembered.
+	loginFailureWindow = 24 * time.Hour
+
+	// loginReserveHold is the longest a login can be checked before another
+	// one to the same username may be tried. It matches the server's write
+	// timeout so a reservation isn't left behind by a stuck request.
+	loginReserveHold = 30 * time.Second
+)
+
+// loginDelay returns how long to wait before another login after the given
+// number of failures. The wait doubles with each failure once the free
+// attempts are used up.
+func loginDelay(failures int) time.Duration {
+	if failures < loginFreeAttempts {
+		return 0
+	}
+	delay := time.Second
+	for i := loginFreeAttempts; i < failures && delay < loginMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, loginMaxDelay)
+}
+
+// reserveLogin claims the next login to a username so logins to it are
+// checked one at a time and each failure is counted before another is tried.
+// If the login can't be tried the error to show is returned instead. Once
+// reserved, releaseLogin must be called when the login is finished.
+func (app *application) reserveLogin(
+	ctx context.Context,
+	username string,
+) (blocked string, err error) {
+	now := time.Now()
+	until, err := app.loginAttempts.Reserve(
+		ctx,
+		username,
+		now,
+		now.Add(loginReserveHold),
+	)
+	if errors.Is(err, models.ErrLoginInProgress) {
+		return "Another login to this account is in progress. Try again in a moment", nil
+	} else if err != nil {
+		return "", err
+	}
+	if !until.IsZero() {
+		return loginWaitError(until.Sub(now)), nil
+	}
+	return "", nil
+}
+
+// releaseLogin ends a reservation from reserveLogin. Failed and successful
+// logins already end it, this makes sure one isn't left behind otherwise, even
+// if the request was canceled.
+func (app *application) releaseLogin(ctx context.Context, username string) {
+	err := app.loginAttempts.Release(context.WithoutCancel(ctx), username)
+	if err != nil {
+		app.errLog.Println("failed releasing login:", err)
+	}
+}
+
+// loginFailed records a failed login to a username and delays the next one.
+// Once enough have failed the account is locked and its owner is emailed. The
+// email is best effort, failing to send it is logged but not returned.
+func (app *application) loginFailed(ctx context.Context, username string) error {
+	now := time.Now()
+	failures, err := app.loginAttempts.Failed(
+		ctx,
+		username,
+		now.Add(-loginFailureWindow),
+	)
+	if err != nil {
+		return err
+	}
+
+	if failures%lockoutAttempts != 0 {
+		return app.loginAttempts.Delay(
+			ctx,
+			username,
+			now.Add(loginDelay(failures)),
+			time.Time{},
+		)
+	}
+
+	until := now.Add(lockoutDuration)
+	err = app.loginAttempts.Delay(ctx, username, until, until)
+	if err != nil {
+		return err
+	}
+	app.infoLog.Println("locked out login:", username)
+
+	// Failures are counted for usernames which don't exist too, they have no
+	// email to send to.
+	email, err := app.users.VerifiedEmail(ctx, username)
+	if err != nil {
+		app.errLog.Println("failed finding lockout email:", err)
+		return nil
+	}
+	if email == "" {
+		return nil
+	}
+	err = app.mailer.Send(ctx, email, "lockout", lockoutEmail{
+		Username: username,
+		Failures: failures,
+		Until:    until,
+	})
+	if err != nil {
+		app.errLog.Println("failed sending lockout email:", err)
+	}
+	return nil
+}
+
+type lockoutEmail struct {
+	Username string
+	Failures int
+	Until    time.Time
+}
+
+// loginWaitError returns the error shown when logins to a username must wait.
+func loginWaitError(wait time.Duration) string {
+	var after string
+	if wait > time.Minute {
+		after = fmt.Sprintf("%d minutes", int((wait+time.Minute-1)/time.Minute))
+	} else if s := int((wait + time.Second - 1) / time.Second); s == 1 {
+		after = "1 second"
+	} else {
+		after = fmt.Sprintf("%d seconds", s)
+	}
+	return "Too many failed login attempts. Try again in " + after
+}
+
+// purgeLoginAttempts periodically removes failed logins once they're
+// forgotten. It runs until the context is canceled.
+func (app *application) purgeLoginAttempts(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		err := app.loginAttempts.Purge(ctx, time.Now().Add(-loginFailureWindow))
+		if err != nil && ctx.Err() == nil {
+			app.errLog.Println("failed purging login attempts:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type adminLockoutsPage struct {
+	Page
+	Form       adminLockoutsForm
+	Attempts   []models.LoginAttempts
+	PageNumber int
+	PageSize   int
+}
+
+type adminLockoutsForm struct {
+	Username string
+
+	// NonFieldErrors stores errors which do not relate to a form field.
+	NonFieldErrors []string
+	// FieldErrors stores errors relating to specific form fields.
+	FieldErrors map[string]string
+}
+
+// adminLockoutsHandler presents the usernames which can't be logged in to
+// because of failed logins so an admin can clear them.
+func (app *application) adminLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdmin(app.authenticated(r)) {
+		http.NotFound(w, r)
+		return
+	}
+	app.renderLockouts(w, r, http.StatusOK, adminLockoutsForm{})
+}
+
+func (app *application) renderLockouts(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	form adminLockoutsForm,
+) {
+	page := page(r.URL.Query())
+	attempts, err := app.loginAttempts.Limited(r.Context(), time.Now(), page)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, status, "adminLockouts.tmpl", adminLockoutsPage{
+		Page: app.newPage(
+			r,
+			"Lockouts - Kudoer",
+			"Accounts blocked by failed logins",
+		),
+		Form:       form,
+		Attempts:   attempts,
+		PageNumber: page,
+		PageSize:   models.PageSize,
+	})
+}
+
+// adminLockoutsPostHandler clears the failed logins for a username so it can
+// be logged in to right away.
+func (app *application) adminLockoutsPostHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdmin(app.authenticated(r)) {
+		http.NotFound(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := adminLockoutsForm{Username: r.PostForm.Get("username")}
+	v := validator.New()
+	v.Username(form.Username)
+
+	var valid bool
+	if form.NonFieldErrors, form.FieldErrors, valid = v.Valid(); !valid {
+		app.renderLockouts(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	err = app.loginAttempts.Clear(r.Context(), form.Username)
+	if errors.Is(err, models.ErrNoRecord) {
+		v.AddFieldError("username", "No failed logins for this username")
+		form.NonFieldErrors, form.FieldErrors, _ = v.Valid()
+		app.renderLockouts(w, r, http.StatusUnprocessableEntity, form)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.infoLog.Println("cleared login lockout:", form.Username, "by", app.authenticated(r))
+	app.flash(r, "Failed logins cleared for "+form.Username)
+	http.Redirect(w, r, "/admin/lockouts", http.StatusSeeOther)
+}
@@ -4,61 +4,252 @@ package mail
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/go-mail/mail/v2"
 )
 
-const resetTMPL = "reset.txt"
+// Every email is a pair of templates, NAME.txt and NAME.html, which define a
+// "subject" and a "body". The bodies are wrapped in the matching layout.
+const (
+	layoutTMPL     = "layout.txt"
+	layoutHTMLTMPL = "layout.html"
+)
 
-//go:embed "reset.txt"
+//go:embed "*.txt" "*.html"
 var EFS embed.FS
 
+// Message is a rendered email which is ready to be sent.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+
+	// HTML is an optional alternative to the plain text body.
+	HTML string
+
+	// Unsubscribe is an optional URL which stops the recipient from getting
+	// more messages like this one. Posting to it must unsubscribe them.
+	Unsubscribe string
+
+	// Expires is when a secret in the message stops working, or the zero
+	// time if it has none. Queued messages are discarded once they expire.
+	Expires time.Time
+}
+
+// Unsubscriber is implemented by email data for messages the recipient can
+// unsubscribe from.
+type Unsubscriber interface {
+	UnsubscribeURL() string
+}
+
+// Expirer is implemented by email data for messages carrying a secret, such as
+// a token, which only works for a while.
+type Expirer interface {
+	Expires() time.Time
+}
+
+// Queue stores rendered messages until they are delivered. Messages may carry
+// secrets so they must not be kept after they expire.
+type Queue interface {
+	Enqueue(
+		ctx context.Context,
+		recipient string,
+		subject string,
+		text string,
+		html string,
+		unsubscribe string,
+		expires time.Time,
+	) error
+}
+
+type templates struct {
+	text *template.Template
+	html *htmltemplate.Template
+}
+
+// Mailer renders email from templates, queues it, and delivers it from a
+// single sender address over a transport.
 type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+	transport Transport
+	queue     Queue
+	sender    string
+	baseURL   string
+	templates map[string]templates
+
+	// queued is signaled when a message is queued.
+	queued chan struct{}
+}
+
+// New creates a Mailer. Links in email are made absolute using the baseURL.
+func New(
+	transport Transport,
+	queue Queue,
+	sender string,
+	baseURL string,
+) (*Mailer, error) {
+	m := &Mailer{
+		transport: transport,
+		queue:     queue,
+		sender:    sender,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		templates: make(map[string]templates),
+		queued:    make(chan struct{}, 1),
+	}
+
+	funcs := map[string]any{
+		"url": func(path string) string {
+			return m.baseURL + path
+		},
+		"unsubscribe": unsubscribeURL,
+	}
+
+	names, err := fs.Glob(EFS, "*.txt")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if name == layoutTMPL {
+			continue
+		}
+		name = strings.TrimSuffix(name, ".txt")
+
+		text, err := template.New(layoutTMPL).
+			Funcs(funcs).
+			ParseFS(EFS, layoutTMPL, name+".txt")
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing email template: %v", err)
+		}
+		html, err := htmltemplate.New(layoutHTMLTMPL).
+			Funcs(funcs).
+			ParseFS(EFS, layoutHTMLTMPL, name+".html")
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing email template: %v", err)
+		}
+		m.templates[name] = templates{text: text, html: html}
+	}
+	return m, nil
 }
 
-func New(host string, port int, username, password, sender string) *Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 10 * time.Second
+// unsubscribeURL returns the unsubscribe link for email data, or a blank
+// string if it can't be unsubscribed from.
+func unsubscribeURL(data any) string {
+	if u, ok := data.(Unsubscriber); ok {
+		return u.UnsubscribeURL()
+	}
+	return ""
+}
 
-	return &Mailer{
-		dialer: dialer,
-		sender: sender,
+// expiry returns when the secret in email data stops working, or the zero
+// time if it has none.
+func expiry(data any) time.Time {
+	if e, ok := data.(Expirer); ok {
+		return e.Expires()
 	}
+	return time.Time{}
 }
 
-// PasswordReset sends a password reset email to a recipient.
-func (m *Mailer) PasswordReset(recipient string, data any) error {
-	tmpl, err := template.New(resetTMPL).ParseFS(EFS, resetTMPL)
+// Render renders the named email for a recipient. The subject is taken from
+// the template.
+func (m *Mailer) Render(recipient, name string, data any) (Message, error) {
+	tmpl, ok := m.templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("email template %v does not exist", name)
+	}
+
+	var subject, plain, rich bytes.Buffer
+	err := tmpl.text.ExecuteTemplate(&subject, "subject", data)
 	if err != nil {
-		return fmt.Errorf("failed parsing email template: %v", err)
+		return Message{}, fmt.Errorf("failed executing email template: %v", err)
+	}
+	if err := tmpl.text.Execute(&plain, data); err != nil {
+		return Message{}, fmt.Errorf("failed executing email template: %v", err)
 	}
+	if err := tmpl.html.Execute(&rich, data); err != nil {
+		return Message{}, fmt.Errorf("failed executing email template: %v", err)
+	}
+
+	return Message{
+		To:          recipient,
+		Subject:     strings.Join(strings.Fields(subject.String()), " "),
+		Text:        plain.String(),
+		HTML:        rich.String(),
+		Unsubscribe: unsubscribeURL(data),
+		Expires:     expiry(data),
+	}, nil
+}
 
-	var b bytes.Buffer
-	err = tmpl.Execute(&b, data)
+// Send renders the named email for a recipient and queues it to be delivered.
+func (m *Mailer) Send(
+	ctx context.Context,
+	recipient string,
+	name string,
+	data any,
+) error {
+	msg, err := m.Render(recipient, name, data)
 	if err != nil {
-		return fmt.Errorf("failed executing email template: %v", err)
+		return err
 	}
 
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", "Kudoer - Password Reset")
-	msg.SetBody("text/plain", b.String())
+	err = m.queue.Enqueue(
+		ctx,
+		msg.To,
+		msg.Subject,
+		msg.Text,
+		msg.HTML,
+		msg.Unsubscribe,
+		msg.Expires,
+	)
+	if err != nil {
+		return err
+	}
+	m.Wake()
+	return nil
+}
 
-	for i := 0; i < 3; i++ {
-		err = m.dialer.DialAndSend(msg)
-		if err == nil {
-			return nil
-		}
+// Queued is signaled whenever a message is queued, so whatever delivers
+// queued messages can do so right away.
+func (m *Mailer) Queued() <-chan struct{} {
+	return m.queued
+}
 
-		time.Sleep(5 * time.Second)
+// Wake signals Queued without queueing a message, such as when a message is
+// put back in the queue.
+func (m *Mailer) Wake() {
+	select {
+	case m.queued <- struct{}{}:
+	default: // Already signaled.
 	}
+}
 
-	return err
+// Deliver makes a single attempt at delivering a message over the transport.
+// Retrying is left to the caller.
+func (m *Mailer) Deliver(ctx context.Context, message Message) error {
+	msg := mail.NewMessage()
+	msg.SetHeader("To", message.To)
+	msg.SetHeader("From", m.sender)
+	msg.SetHeader("Subject", message.Subject)
+	if message.Unsubscribe != "" {
+		// Allow one-click unsubscribing as described in RFC 8058.
+		msg.SetHeader("List-Unsubscribe", "<"+message.Unsubscribe+">")
+		msg.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	msg.SetBody("text/plain", message.Text)
+	if message.HTML != "" {
+		msg.AddAlternative("text/html", message.HTML)
+	}
+	return mail.Send(
+		mail.SendFunc(func(from string, to []string, msg io.WriterTo) error {
+			return m.transport.Send(ctx, from, to, msg)
+		}),
+		msg,
+	)
 }
@@ -0,0 +1,307 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryQueue keeps queued messages in memory.
+type memoryQueue []Message
+
+func (q *memoryQueue) Enqueue(
+	ctx context.Context,
+	recipient string,
+	subject string,
+	text string,
+	html string,
+	unsubscribe string,
+	expires time.Time,
+) error {
+	*q = append(*q, Message{
+		To:          recipient,
+		Subject:     subject,
+		Text:        text,
+		HTML:        html,
+		Unsubscribe: unsubscribe,
+		Expires:     expires,
+	})
+	return nil
+}
+
+func newMailer(t *testing.T, transport Transport) *Mailer {
+	m, err := New(
+		transport,
+		&memoryQueue{},
+		"Kudoer <no-reply@kudoer.com>",
+		"https://kudoer.example/",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+type testDigest struct {
+	DisplayName string
+	Frequency   string
+	Kudos       []struct{}
+	Followers   []struct {
+		Username    string
+		DisplayName string
+	}
+}
+
+func (d testDigest) UnsubscribeURL() string {
+	return "https://kudoer.example/digest/unsubscribe?token=SECRET"
+}
+
+// testReset is password reset email data.
+type testReset struct {
+	Token  string
+	expiry time.Time
+}
+
+func (r testReset) Expires() time.Time {
+	return r.expiry
+}
+
+func TestSend(t *testing.T) {
+	q := &memoryQueue{}
+	m, err := New(
+		&Dir{Path: t.TempDir()},
+		q,
+		"no-reply@kudoer.com",
+		"https://kudoer.example/",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiry := time.Now().Add(45 * time.Minute)
+	err = m.Send(
+		context.Background(),
+		"alice@example.com",
+		"reset",
+		testReset{Token: "TOKEN", expiry: expiry},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := testDigest{DisplayName: "Alice", Frequency: "weekly"}
+	digest.Followers = append(digest.Followers, struct {
+		Username    string
+		DisplayName string
+	}{"bob", "Bob <3"})
+	err = m.Send(context.Background(), "alice@example.com", "digest", digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Send(context.Background(), "alice@example.com", "nope", nil)
+	if err == nil {
+		t.Fatal("expected an error for a missing template")
+	}
+
+	select {
+	case <-m.Queued():
+	default:
+		t.Fatal("queueing a message didn't signal Queued")
+	}
+
+	if len(*q) != 2 {
+		t.Fatalf("got %d queued messages want 2", len(*q))
+	}
+	reset, weekly := (*q)[0], (*q)[1]
+
+	if reset.Subject != "Kudoer - Password Reset" {
+		t.Fatalf("got subject %q", reset.Subject)
+	}
+	if reset.Unsubscribe != "" {
+		t.Fatalf("password reset has unsubscribe link %q", reset.Unsubscribe)
+	}
+	if !reset.Expires.Equal(expiry) {
+		t.Fatalf("got reset expiry %v want %v", reset.Expires, expiry)
+	}
+	for _, want := range []string{
+		"https://kudoer.example/user/reset",
+		"TOKEN",
+		"--\nKudoer\nhttps://kudoer.example/",
+	} {
+		if !strings.Contains(reset.Text, want) {
+			t.Fatalf("reset text missing %q:\n%s", want, reset.Text)
+		}
+	}
+	if !strings.Contains(reset.HTML, "<strong>TOKEN</strong>") ||
+		!strings.Contains(reset.HTML, "<title>Kudoer - Password Reset</title>") {
+		t.Fatalf("unexpected reset HTML:\n%s", reset.HTML)
+	}
+
+	if weekly.Subject != "Kudoer - Your weekly digest" {
+		t.Fatalf("got subject %q", weekly.Subject)
+	}
+	if !weekly.Expires.IsZero() {
+		t.Fatalf("digest without a secret expires at %v", weekly.Expires)
+	}
+	if weekly.Unsubscribe != digest.UnsubscribeURL() {
+		t.Fatalf("got unsubscribe link %q", weekly.Unsubscribe)
+	}
+	if !strings.Contains(weekly.Text, digest.UnsubscribeURL()) {
+		t.Fatalf("digest text missing unsubscribe link:\n%s", weekly.Text)
+	}
+	if !strings.Contains(weekly.HTML, "Bob &lt;3") {
+		t.Fatalf("digest HTML isn't escaped:\n%s", weekly.HTML)
+	}
+}
+
+func TestDeliverUnsubscribe(t *testing.T) {
+	dir := &Dir{Path: t.TempDir()}
+	m := newMailer(t, dir)
+	err := m.Deliver(context.Background(), Message{
+		To:          "alice@example.com",
+		Subject:     "Digest",
+		Text:        "Hi",
+		Unsubscribe: "https://kudoer.example/digest/unsubscribe?token=SECRET",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := dir.Messages()
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("got messages %v: %v", paths, err)
+	}
+	b, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"List-Unsubscribe: <https://kudoer.example/digest/unsubscribe?token=SECRET>",
+		"List-Unsubscribe-Post: List-Unsubscribe=One-Click",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("message missing %q:\n%s", want, b)
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir := &Dir{Path: filepath.Join(t.TempDir(), "mail")}
+	m := newMailer(t, dir)
+
+	subjects := []string{"First", "Second"}
+	for _, subject := range subjects {
+		err := m.Deliver(context.Background(), Message{
+			To:      "alice@example.com",
+			Subject: subject,
+			Text:    "Hello Alice",
+			HTML:    "<p>Hello Alice</p>",
+		})
+		if err != nil {
+			t.Fatalf("failed sending %v: %v", subject, err)
+		}
+	}
+
+	paths, err := dir.Messages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != len(subjects) {
+		t.Fatalf("got %d messages want %d", len(paths), len(subjects))
+	}
+
+	for i, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := string(b)
+		for _, want := range []string{
+			"To: alice@example.com",
+			"From: Kudoer <no-reply@kudoer.com>",
+			"Subject: " + subjects[i],
+			"Content-Type: text/plain",
+			"Content-Type: text/html",
+			"<p>Hello Alice</p>",
+		} {
+			if !strings.Contains(msg, want) {
+				t.Fatalf("message %d missing %q:\n%s", i, want, msg)
+			}
+		}
+	}
+}
+
+func TestSendmail(t *testing.T) {
+	tmp := t.TempDir()
+	out := filepath.Join(tmp, "out")
+	script := filepath.Join(tmp, "sendmail")
+	err := os.WriteFile(
+		script,
+		[]byte("#!/bin/sh\necho \"$@\" > "+out+".args\ncat > "+out+"\n"),
+		0o700,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newMailer(t, &Sendmail{Path: script})
+	err = m.Deliver(context.Background(), Message{
+		To:      "bob@example.com",
+		Subject: "Hi",
+		Text:    "Hello Bob",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := os.ReadFile(out + ".args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "-i -f no-reply@kudoer.com -- bob@example.com"
+	if got := strings.TrimSpace(string(args)); got != want {
+		t.Fatalf("got args %q want %q", got, want)
+	}
+
+	msg, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(msg), "Subject: Hi") ||
+		!strings.Contains(string(msg), "Hello Bob") {
+		t.Fatalf("unexpected message:\n%s", msg)
+	}
+}
+
+func TestSendmailFailure(t *testing.T) {
+	m := newMailer(t, &Sendmail{Path: "/bin/false"})
+	err := m.Deliver(context.Background(), Message{To: "bob@example.com", Subject: "Hi", Text: "Hi"})
+	if err == nil {
+		t.Fatal("expected an error from a failing sendmail")
+	}
+}
+
+func TestSendmailTimeout(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "sendmail")
+	err := os.WriteFile(script, []byte("#!/bin/sh\nexec sleep 60\n"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newMailer(t, &Sendmail{Path: script})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = m.Deliver(ctx, Message{To: "bob@example.com", Subject: "Hi", Text: "Hi"})
+	if err == nil {
+		t.Fatal("expected an error from a sendmail which never finishes")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("sendmail wasn't stopped until %v", elapsed)
+	}
+}
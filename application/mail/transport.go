@@ -0,0 +1,138 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+// sendTimeout limits how long a transport may take to deliver a message, so a
+// stuck mail server or binary can't hold up the outbox forever.
+const sendTimeout = 10 * time.Second
+
+// Transport delivers a fully built message from a sender to its recipients.
+// It should give up when the context is done.
+type Transport interface {
+	Send(ctx context.Context, from string, to []string, msg io.WriterTo) error
+}
+
+// SMTP delivers messages through an SMTP server.
+type SMTP struct {
+	dialer *mail.Dialer
+}
+
+// NewSMTP creates a transport which connects to an SMTP server for every
+// message.
+func NewSMTP(host string, port int, username, password string) *SMTP {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = sendTimeout
+	return &SMTP{dialer: dialer}
+}
+
+// Send delivers a message. The dialer's timeout bounds each step of talking to
+// the server, so the context is only checked before connecting.
+func (t *SMTP) Send(
+	ctx context.Context,
+	from string,
+	to []string,
+	msg io.WriterTo,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s, err := t.dialer.Dial()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Send(from, to, msg)
+}
+
+// Sendmail delivers messages by piping them to a local sendmail compatible
+// binary.
+type Sendmail struct {
+	Path string
+}
+
+// Send delivers a message. The binary is killed if it runs longer than
+// sendTimeout or the context is done.
+func (t *Sendmail) Send(
+	ctx context.Context,
+	from string,
+	to []string,
+	msg io.WriterTo,
+) error {
+	var b bytes.Buffer
+	if _, err := msg.WriteTo(&b); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	args := append([]string{"-i", "-f", from, "--"}, to...)
+	cmd := exec.CommandContext(ctx, t.Path, args...)
+	cmd.Stdin = &b
+
+	// Don't wait on output from anything the binary left running after it
+	// was killed.
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf(
+			"sendmail failed: %v: %s",
+			err,
+			strings.TrimSpace(string(out)),
+		)
+	}
+	return nil
+}
+
+// Dir writes each message to a .eml file in a directory instead of sending it.
+// It is meant for development and tests.
+type Dir struct {
+	Path string
+}
+
+func (t *Dir) Send(
+	ctx context.Context,
+	from string,
+	to []string,
+	msg io.WriterTo,
+) error {
+	err := os.MkdirAll(t.Path, 0o750)
+	if err != nil {
+		return err
+	}
+
+	// Prefix the name with the time so the files sort in the order they were
+	// sent.
+	pattern := fmt.Sprintf("%d-*.eml", time.Now().UnixNano())
+	f, err := os.CreateTemp(t.Path, pattern)
+	if err != nil {
+		return err
+	}
+	_, err = msg.WriteTo(f)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	return f.Close()
+}
+
+// Messages returns the paths of the messages written to the directory, oldest
+// first.
+func (t *Dir) Messages() ([]string, error) {
+	return filepath.Glob(filepath.Join(t.Path, "*.eml"))
+}
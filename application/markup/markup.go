@@ -0,0 +1,282 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+
+// Package markup renders a small, safe subset of markdown to HTML.
+//
+// Blocks are separated by blank lines. A block is a paragraph, a block quote
+// with lines starting with ">", a list with lines starting with "-", "*" or
+// "+", or a numbered list with lines like "1.". Within a block *emphasis*,
+// **strong emphasis**, [links](https://example.com), bare http(s) links, and
+// @username mentions are understood. Everything else is escaped, so the output
+// never contains markup the author didn't write through this syntax.
+package markup
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxDepth limits how deeply block quotes may be nested.
+const maxDepth = 8
+
+// Render converts source text to sanitized HTML.
+func Render(source string) template.HTML {
+	return RenderMentions(source, nil)
+}
+
+// RenderMentions converts source text to sanitized HTML. Mentions of the given
+// usernames link to their profiles while other mentions are left as text.
+func RenderMentions(source string, usernames []string) template.HTML {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+
+	mentions := make(map[string]bool, len(usernames))
+	for _, u := range usernames {
+		mentions[u] = true
+	}
+
+	r := renderer{mentions: mentions}
+	r.blocks(strings.Split(source, "\n"), 0)
+	return template.HTML(r.b.String())
+}
+
+// renderer holds the output of a render along with the users who may be
+// mentioned.
+type renderer struct {
+	b        strings.Builder
+	mentions map[string]bool
+}
+
+// blocks renders a list of lines as block level elements.
+func (r *renderer) blocks(lines []string, depth int) {
+	b := &r.b
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case depth < maxDepth && isQuote(line):
+			var quoted []string
+			for ; i < len(lines) && isQuote(lines[i]); i++ {
+				l := strings.TrimPrefix(strings.TrimLeft(lines[i], " "), ">")
+				quoted = append(quoted, strings.TrimPrefix(l, " "))
+			}
+			b.WriteString("<blockquote>")
+			r.blocks(quoted, depth+1)
+			b.WriteString("</blockquote>")
+		case listItem(line) != "":
+			tag := listItem(line)
+			b.WriteString("<" + tag + ">")
+			for i < len(lines) && listItem(lines[i]) == tag {
+				item := []string{itemText(lines[i])}
+				i++
+				// Indented lines continue the item above them.
+				for ; i < len(lines) && continues(lines[i]); i++ {
+					item = append(item, strings.TrimSpace(lines[i]))
+				}
+				b.WriteString("<li>")
+				r.inlines(strings.Join(item, "\n"), false)
+				b.WriteString("</li>")
+			}
+			b.WriteString("</" + tag + ">")
+		default:
+			var para []string
+			for ; i < len(lines) && !startsBlock(lines[i], depth); i++ {
+				para = append(para, strings.TrimSpace(lines[i]))
+			}
+			b.WriteString("<p>")
+			r.inlines(strings.Join(para, "\n"), false)
+			b.WriteString("</p>")
+		}
+	}
+}
+
+// startsBlock reports if a line ends the paragraph before it.
+func startsBlock(line string, depth int) bool {
+	return strings.TrimSpace(line) == "" ||
+		(depth < maxDepth && isQuote(line)) ||
+		listItem(line) != ""
+}
+
+func isQuote(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+// continues reports if a line is an indented continuation of a list item.
+func continues(line string) bool {
+	return strings.HasPrefix(line, "  ") && strings.TrimSpace(line) != "" &&
+		listItem(line) == ""
+}
+
+// listItem returns "ul" or "ol" if the line starts a list item of that kind.
+func listItem(line string) string {
+	if strings.HasPrefix(line, "- ") ||
+		strings.HasPrefix(line, "* ") ||
+		strings.HasPrefix(line, "+ ") {
+		return "ul"
+	}
+	digits := strings.IndexFunc(line, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if digits > 0 && digits <= 9 && strings.HasPrefix(line[digits:], ". ") {
+		return "ol"
+	}
+	return ""
+}
+
+// itemText returns a list item line without its marker.
+func itemText(line string) string {
+	_, text, _ := strings.Cut(line, " ")
+	return strings.TrimSpace(text)
+}
+
+// inlines renders emphasis and links within a block. Line breaks are kept.
+// Links are not allowed inside other links.
+func (r *renderer) inlines(text string, inLink bool) {
+	b := &r.b
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch {
+		case strings.HasPrefix(rest, "**"):
+			if inner, n, ok := delimited(rest, "**"); ok {
+				b.WriteString("<strong>")
+				r.inlines(inner, inLink)
+				b.WriteString("</strong>")
+				i += n
+				continue
+			}
+		case rest[0] == '*' || (rest[0] == '_' && wordStart(text, i)):
+			if inner, n, ok := delimited(rest, rest[:1]); ok {
+				b.WriteString("<em>")
+				r.inlines(inner, inLink)
+				b.WriteString("</em>")
+				i += n
+				continue
+			}
+		case rest[0] == '[' && !inLink:
+			if label, href, n, ok := link(rest); ok {
+				writeLink(b, href)
+				r.inlines(label, true)
+				b.WriteString("</a>")
+				i += n
+				continue
+			}
+		case !inLink && wordStart(text, i) &&
+			(strings.HasPrefix(rest, "https://") ||
+				strings.HasPrefix(rest, "http://")):
+			if href, n := bareLink(rest); href != "" {
+				writeLink(b, href)
+				b.WriteString(html.EscapeString(rest[:n]))
+				b.WriteString("</a>")
+				i += n
+				continue
+			}
+		case rest[0] == '@' && !inLink && wordStart(text, i):
+			if username := mention(rest); r.mentions[username] {
+				b.WriteString(`<a class="link" href="/user/view/`)
+				b.WriteString(html.EscapeString(username))
+				b.WriteString(`">@`)
+				b.WriteString(html.EscapeString(username))
+				b.WriteString("</a>")
+				i += len(username) + 1
+				continue
+			}
+		case rest[0] == '\n':
+			b.WriteString("<br />")
+			i++
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		b.WriteString(html.EscapeString(rest[:size]))
+		i += size
+	}
+}
+
+// delimited finds text wrapped in a delimiter at the start of s. The wrapped
+// text must not start or end with a space. It returns the wrapped text and the
+// length of s which was used.
+func delimited(s, delim string) (string, int, bool) {
+	end := strings.Index(s[len(delim):], delim)
+	if end <= 0 {
+		return "", 0, false
+	}
+	inner := s[len(delim) : len(delim)+end]
+	first, _ := utf8.DecodeRuneInString(inner)
+	last, _ := utf8.DecodeLastRuneInString(inner)
+	if unicode.IsSpace(first) || unicode.IsSpace(last) {
+		return "", 0, false
+	}
+	return inner, len(delim)*2 + end, true
+}
+
+// link parses a [label](url) link at the start of s.
+func link(s string) (label, href string, n int, ok bool) {
+	closing := strings.Index(s, "](")
+	if closing <= 1 || strings.Contains(s[:closing], "\n") {
+		return "", "", 0, false
+	}
+	end := strings.IndexAny(s[closing+2:], ") \n")
+	if end <= 0 || s[closing+2+end] != ')' {
+		return "", "", 0, false
+	}
+	href = safeURL(s[closing+2 : closing+2+end])
+	if href == "" {
+		return "", "", 0, false
+	}
+	return s[1:closing], href, closing + 3 + end, true
+}
+
+// bareLink parses a URL written directly in the text at the start of s.
+// Trailing punctuation is left out of the link.
+func bareLink(s string) (string, int) {
+	end := strings.IndexFunc(s, unicode.IsSpace)
+	if end < 0 {
+		end = len(s)
+	}
+	end = len(strings.TrimRight(s[:end], ".,;:!?'\")]*_"))
+	return safeURL(s[:end]), end
+}
+
+// mention returns the username of an @username mention at the start of s.
+func mention(s string) string {
+	end := strings.IndexFunc(s[1:], func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' ||
+			r == '-')
+	})
+	if end < 0 {
+		return s[1:]
+	}
+	return s[1 : end+1]
+}
+
+// wordStart reports if position i in text begins a new word.
+func wordStart(text string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return unicode.IsSpace(r) || r == '('
+}
+
+// safeURL returns the URL if it is an absolute http(s) URL, otherwise blank.
+func safeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
+
+func writeLink(b *strings.Builder, href string) {
+	b.WriteString(`<a class="link" href="`)
+	b.WriteString(html.EscapeString(href))
+	b.WriteString(`" rel="nofollow ugc">`)
+}
@@ -0,0 +1,158 @@
+package markup
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	type test struct {
+		description string
+		input       string
+		want        template.HTML
+	}
+
+	tests := []test{
+		{
+			description: "Blank",
+			input:       "",
+			want:        "",
+		},
+		{
+			description: "Paragraphs and line breaks",
+			input:       "First line\nsecond line\n\nNew paragraph",
+			want:        "<p>First line<br />second line</p><p>New paragraph</p>",
+		},
+		{
+			description: "Windows line endings",
+			input:       "One\r\n\r\nTwo",
+			want:        "<p>One</p><p>Two</p>",
+		},
+		{
+			description: "Emphasis",
+			input:       "A *truly* **great** _read_",
+			want:        "<p>A <em>truly</em> <strong>great</strong> <em>read</em></p>",
+		},
+		{
+			description: "Unclosed emphasis",
+			input:       "5 * 3 and snake_case_name",
+			want:        "<p>5 * 3 and snake_case_name</p>",
+		},
+		{
+			description: "HTML is escaped",
+			input:       `<script>alert("hi")</script> & <b>`,
+			want:        "<p>&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt; &amp; &lt;b&gt;</p>",
+		},
+		{
+			description: "Link",
+			input:       "See [the site](https://example.com/a?b=1&c=2).",
+			want:        `<p>See <a class="link" href="https://example.com/a?b=1&amp;c=2" rel="nofollow ugc">the site</a>.</p>`,
+		},
+		{
+			description: "Bare link",
+			input:       "Found at https://example.com/book.",
+			want:        `<p>Found at <a class="link" href="https://example.com/book" rel="nofollow ugc">https://example.com/book</a>.</p>`,
+		},
+		{
+			description: "Javascript link",
+			input:       "[click](javascript:alert(1))",
+			want:        "<p>[click](javascript:alert(1))</p>",
+		},
+		{
+			description: "Relative link",
+			input:       "[home](/user/view/kota)",
+			want:        "<p>[home](/user/view/kota)</p>",
+		},
+		{
+			description: "Link label cannot contain links",
+			input:       "[https://a.example](https://b.example)",
+			want:        `<p><a class="link" href="https://b.example" rel="nofollow ugc">https://a.example</a></p>`,
+		},
+		{
+			description: "Block quote",
+			input:       "> Quoted *text*\n> more\n\nAfter",
+			want:        "<blockquote><p>Quoted <em>text</em><br />more</p></blockquote><p>After</p>",
+		},
+		{
+			description: "Nested block quote",
+			input:       "> > deep",
+			want:        "<blockquote><blockquote><p>deep</p></blockquote></blockquote>",
+		},
+		{
+			description: "Unordered list",
+			input:       "Pros:\n- funny\n- short\n  and sweet\n* cheap",
+			want:        "<p>Pros:</p><ul><li>funny</li><li>short<br />and sweet</li><li>cheap</li></ul>",
+		},
+		{
+			description: "Ordered list",
+			input:       "1. Read it\n2. Loved it",
+			want:        "<ol><li>Read it</li><li>Loved it</li></ol>",
+		},
+	}
+
+	for _, tc := range tests {
+		got := Render(tc.input)
+		if got != tc.want {
+			t.Fatalf(
+				"%v: got:\n%v\nwant:\n%v\n",
+				tc.description,
+				got,
+				tc.want,
+			)
+		}
+	}
+}
+
+func TestRenderMentions(t *testing.T) {
+	type test struct {
+		description string
+		input       string
+		usernames   []string
+		want        template.HTML
+	}
+
+	tests := []test{
+		{
+			description: "Known user",
+			input:       "Thanks @kota!",
+			usernames:   []string{"kota"},
+			want:        `<p>Thanks <a class="link" href="/user/view/kota">@kota</a>!</p>`,
+		},
+		{
+			description: "Unknown user",
+			input:       "Thanks @nobody",
+			usernames:   []string{"kota"},
+			want:        "<p>Thanks @nobody</p>",
+		},
+		{
+			description: "Email address",
+			input:       "me@kota",
+			usernames:   []string{"kota"},
+			want:        "<p>me@kota</p>",
+		},
+		{
+			description: "Inside emphasis",
+			input:       "*@kota*",
+			usernames:   []string{"kota"},
+			want:        `<p><em><a class="link" href="/user/view/kota">@kota</a></em></p>`,
+		},
+		{
+			description: "Inside a link label",
+			input:       "[@kota](https://example.com)",
+			usernames:   []string{"kota"},
+			want:        `<p><a class="link" href="https://example.com" rel="nofollow ugc">@kota</a></p>`,
+		},
+	}
+
+	for _, tc := range tests {
+		got := RenderMentions(tc.input, tc.usernames)
+		if got != tc.want {
+			t.Fatalf(
+				"%v: got:\n%v\nwant:\n%v\n",
+				tc.description,
+				got,
+				tc.want,
+			)
+		}
+	}
+}
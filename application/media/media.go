@@ -5,6 +5,7 @@ package media
 import (
 	"bytes"
 	"crypto/sha1"
+	"errors"
 	"fmt"
 	"image"
 	"io"
@@ -20,6 +21,9 @@ import (
 	"github.com/muesli/smartcrop/nfnt"
 )
 
+// ErrDecode is returned when an uploaded file could not be read as an image.
+var ErrDecode = errors.New("media: failed decoding image")
+
 type MediaStore struct {
 	msn string
 }
@@ -71,6 +75,36 @@ func (m *MediaStore) StorePic(src io.Reader) (string, string, error) {
 	return filename512, filename128, nil
 }
 
+// DecodeCover decodes an item's cover image so it can be checked before it's
+// stored with StoreCover.
+func DecodeCover(src io.Reader) (image.Image, error) {
+	img, err := imaging.Decode(src, imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecode, err)
+	}
+	return img, nil
+}
+
+// StoreCover stores an item's cover image.
+// Unlike StorePic the image is not cropped, instead it is scaled down to fit
+// within a 600x900px and a 150x225px box, keeping its aspect ratio. Images
+// smaller than a box are left at their original size. The filenames are
+// returned in that order.
+func (m *MediaStore) StoreCover(img image.Image) (string, string, error) {
+	large := imaging.Fit(img, 600, 900, imaging.Lanczos)
+	small := imaging.Fit(img, 150, 225, imaging.Lanczos)
+
+	filenameLarge, err := m.store(large)
+	if err != nil {
+		return "", "", fmt.Errorf("failed storing image: %v", err)
+	}
+	filenameSmall, err := m.store(small)
+	if err != nil {
+		return "", "", fmt.Errorf("failed storing image: %v", err)
+	}
+	return filenameLarge, filenameSmall, nil
+}
+
 // resize an image to a specific profile picture size.
 func resize(img image.Image, crop image.Rectangle, size int) (image.Image, error) {
 	// Crop to a square around the content.
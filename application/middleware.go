@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 
+	"git.sr.ht/~kota/kudoer/db/litesession"
 	"git.sr.ht/~kota/kudoer/ui"
 	"github.com/justinas/nosurf"
 )
@@ -98,16 +99,9 @@ func nonce(c context.Context) string {
 // logRequest is a middleware that prints each request to the info log.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		addr := r.RemoteAddr
-
-		// Use correct address if behind proxy.
-		if proxyAddr := r.Header.Get("X-Forwarded-For"); proxyAddr != "" {
-			addr = proxyAddr
-		}
-
 		app.infoLog.Printf(
 			"%s - %s %s %s",
-			addr,
+			app.clientIP(r),
 			r.Proto,
 			r.Method,
 			r.URL.RequestURI(),
@@ -116,6 +110,19 @@ func (app *application) logRequest(next http.Handler) http.Handler {
 	})
 }
 
+// sessionClient is a middleware which tells the session store who is making
+// the request so it can be shown in the user's list of sessions. It must come
+// before the session is loaded.
+func (app *application) sessionClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := litesession.WithClient(r.Context(), litesession.Client{
+			IP:        app.clientIP(r),
+			UserAgent: r.UserAgent(),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // recoverPanic is a middleware which recovers from a panic and logs the error.
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,76 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package application
+
+import (
+	"fmt"
+	"net/http"
+
+	"git.sr.ht/~kota/kudoer/db/models"
+	"github.com/oklog/ulid"
+)
+
+type notificationsPage struct {
+	Page
+	PageNumber int
+	PageSize   int
+
+	Notifications []models.Notification
+}
+
+// notificationsHandler presents the current user's notifications.
+func (app *application) notificationsHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	page := page(params)
+
+	notifications, err := app.notifications.List(
+		r.Context(),
+		app.authenticated(r),
+		page,
+	)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, http.StatusOK, "notifications.tmpl", notificationsPage{
+		Page:          app.newPage(r, "Notifications - Kudoer", "Your notifications."),
+		PageNumber:    page,
+		PageSize:      models.PageSize,
+		Notifications: notifications,
+	})
+}
+
+// notificationsReadPostHandler marks notifications as read. With "all" set
+// every notification up to the given one is marked, otherwise only the given
+// notification and those grouped with it.
+func (app *application) notificationsReadPostHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id, err := ulid.Parse(r.PostForm.Get("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	username := app.authenticated(r)
+	if r.PostForm.Get("all") != "" {
+		err = app.notifications.ReadAll(r.Context(), username, id)
+	} else {
+		err = app.notifications.Read(r.Context(), username, id)
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	redirect := "/notifications"
+	if p := page(r.PostForm); p > 1 {
+		redirect = fmt.Sprintf("/notifications?page=%d", p)
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
@@ -0,0 +1,204 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"git.sr.ht/~kota/kudoer/application/mail"
+	"git.sr.ht/~kota/kudoer/db/models"
+	"github.com/oklog/ulid"
+)
+
+const (
+	// outboxInterval is how often the outbox is checked for messages which
+	// are due to be retried.
+	outboxInterval = 30 * time.Second
+
+	// outboxBackoff is how long to wait after a message fails to send the
+	// first time. The wait doubles after each failure up to outboxMaxBackoff.
+	outboxBackoff    = time.Minute
+	outboxMaxBackoff = 12 * time.Hour
+
+	// outboxMaxAttempts is how many times sending a message may fail before
+	// it is given up on and left for an admin.
+	outboxMaxAttempts = 8
+)
+
+// sendMail sends messages from the outbox whenever some are queued or due to
+// be retried. It runs until the context is canceled, but never gives up on a
+// message it already started sending.
+func (app *application) sendMail(ctx context.Context) {
+	ticker := time.NewTicker(outboxInterval)
+	defer ticker.Stop()
+	for {
+		app.flushOutbox(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-app.mailer.Queued():
+		}
+	}
+}
+
+// flushOutbox sends every message which is due. Messages whose secrets expired
+// are deleted first, including ones which are dead.
+func (app *application) flushOutbox(ctx context.Context) {
+	err := app.outbox.Expire(ctx, time.Now())
+	if err != nil && ctx.Err() == nil {
+		app.errLog.Println("failed expiring outbox:", err)
+	}
+
+	for ctx.Err() == nil {
+		msg, err := app.outbox.Next(ctx, time.Now())
+		if errors.Is(err, models.ErrNoRecord) {
+			return
+		} else if err != nil {
+			if ctx.Err() == nil {
+				app.errLog.Println("failed reading outbox:", err)
+			}
+			return
+		}
+
+		// Shutting down doesn't interrupt a message being sent, the transport
+		// gives up on its own if it takes too long.
+		sendErr := app.mailer.Deliver(context.WithoutCancel(ctx), mail.Message{
+			To:          msg.Recipient,
+			Subject:     msg.Subject,
+			Text:        msg.Text,
+			HTML:        msg.HTML,
+			Unsubscribe: msg.Unsubscribe,
+		})
+
+		// Record the outcome even when shutting down, otherwise a sent message
+		// would be sent again.
+		ctx := context.WithoutCancel(ctx)
+		if sendErr == nil {
+			err = app.outbox.Sent(ctx, msg.ID)
+		} else {
+			attempts := msg.Attempts + 1
+			dead := attempts >= outboxMaxAttempts
+			if dead {
+				app.errLog.Printf(
+					"giving up sending mail %v after %d attempts: %v",
+					msg.ID,
+					attempts,
+					sendErr,
+				)
+			}
+			err = app.outbox.Failed(
+				ctx,
+				msg.ID,
+				sendErr.Error(),
+				time.Now().Add(backoff(attempts)),
+				dead,
+			)
+		}
+		if err != nil {
+			app.errLog.Println("failed updating outbox:", err)
+			return
+		}
+	}
+}
+
+// backoff returns how long to wait before retrying a message which failed to
+// send the given number of times.
+func backoff(attempts int) time.Duration {
+	wait := float64(outboxBackoff) * math.Pow(2, float64(attempts-1))
+	if wait > float64(outboxMaxBackoff) {
+		return outboxMaxBackoff
+	}
+	return time.Duration(wait)
+}
+
+type adminOutboxPage struct {
+	Page
+	Messages   []models.OutboxMessage
+	PageNumber int
+	PageSize   int
+}
+
+// adminOutboxHandler presents the messages which failed to send so an admin
+// can retry or discard them.
+func (app *application) adminOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdmin(app.authenticated(r)) {
+		http.NotFound(w, r)
+		return
+	}
+
+	page := page(r.URL.Query())
+	msgs, err := app.outbox.Stuck(r.Context(), page)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, http.StatusOK, "adminOutbox.tmpl", adminOutboxPage{
+		Page: app.newPage(
+			r,
+			"Outbox - Kudoer",
+			"Email which failed to send",
+		),
+		Messages:   msgs,
+		PageNumber: page,
+		PageSize:   models.PageSize,
+	})
+}
+
+// adminOutboxPostHandler retries or discards a message in the outbox.
+func (app *application) adminOutboxPostHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdmin(app.authenticated(r)) {
+		http.NotFound(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id, err := ulid.Parse(r.PostForm.Get("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var flash string
+	switch r.PostForm.Get("action") {
+	case "retry":
+		err = app.outbox.Retry(r.Context(), id)
+		flash = "Message will be sent again"
+	case "discard":
+		err = app.outbox.Discard(r.Context(), id)
+		flash = "Message discarded"
+	default:
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.mailer.Wake()
+
+	app.flash(r, flash)
+	redirect := "/admin/outbox"
+	if p := page(r.PostForm); p > 1 {
+		redirect = fmt.Sprintf("/admin/outbox?page=%d", p)
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
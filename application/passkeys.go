@@ -0,0 +1,314 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package application
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"git.sr.ht/~kota/kudoer/application/validator"
+	"git.sr.ht/~kota/kudoer/application/webauthn"
+	"git.sr.ht/~kota/kudoer/db/models"
+)
+
+// The content security policy doesn't allow scripts to make requests, so the
+// WebAuthn ceremonies don't have their own endpoints for starting them. The
+// page which shows the passkey button starts the ceremony by putting a new
+// challenge in the session, and its script posts the browser's response in
+// a regular form.
+
+// newPasskeyChallenge starts a WebAuthn ceremony. The challenge is stored in
+// the session, replacing any earlier one, and returned encoded for the
+// browser.
+func (app *application) newPasskeyChallenge(r *http.Request) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+	app.sessionManager.Put(r.Context(), "passkeyChallenge", challenge)
+	return webauthn.Encoding.EncodeToString(challenge), nil
+}
+
+// passkeyField decodes a binary value the browser sent in a form field.
+func passkeyField(r *http.Request, key string) ([]byte, bool) {
+	b, err := webauthn.Encoding.DecodeString(r.PostForm.Get(key))
+	return b, err == nil && len(b) > 0
+}
+
+// userLoginPasskeyPostHandler logs a user in with one of their passkeys.
+func (app *application) userLoginPasskeyPostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 16384)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// A challenge can only be used once.
+	challenge := app.sessionManager.PopBytes(r.Context(), "passkeyChallenge")
+
+	id, ok1 := passkeyField(r, "id")
+	clientData, ok2 := passkeyField(r, "clientDataJSON")
+	authData, ok3 := passkeyField(r, "authenticatorData")
+	signature, ok4 := passkeyField(r, "signature")
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	userHandle, hasUserHandle := passkeyField(r, "userHandle")
+	rememberMe := r.PostForm.Has("remember")
+
+	failed := func() {
+		v := validator.New()
+		v.AddNonFieldError("Passkey could not be verified")
+		form := userLoginForm{RememberMe: rememberMe}
+		form.NonFieldErrors, form.FieldErrors, _ = v.Valid()
+		app.renderLogin(w, r, http.StatusUnprocessableEntity, form)
+	}
+
+	passkey, err := app.passkeys.Get(r.Context(), id)
+	if errors.Is(err, models.ErrNoRecord) {
+		failed()
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The user handle is the username the passkey was registered with.
+	if hasUserHandle && string(userHandle) != passkey.Username {
+		failed()
+		return
+	}
+
+	assertion, err := app.relyingParty.VerifyAssertion(
+		challenge,
+		webauthn.Credential{
+			ID:        passkey.ID,
+			PublicKey: passkey.PublicKey,
+			SignCount: passkey.SignCount,
+		},
+		clientData,
+		authData,
+		signature,
+	)
+	if errors.Is(err, webauthn.ErrVerification) {
+		app.infoLog.Println("failed passkey login:", passkey.Username, err)
+		failed()
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.passkeys.Used(r.Context(), passkey.ID, assertion.SignCount)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// A passkey which verified the user with a PIN or biometric is already
+	// two factors. Otherwise users with two-factor authentication still need
+	// to enter a code.
+	if !assertion.UserVerified {
+		secret, err := app.twoFactor.Secret(r.Context(), passkey.Username)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if secret != "" {
+			err = app.startTwoFactor(r, passkey.Username, rememberMe)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+			return
+		}
+	}
+
+	err = app.login(r, passkey.Username, rememberMe)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+type passkeysPage struct {
+	Page
+	Passkeys []passkeyView
+
+	// The options for registering a new passkey.
+	Challenge  string
+	Exclude    []string
+	RPID       string
+	Algorithms []int
+
+	Form passkeysForm
+}
+
+type passkeyView struct {
+	models.Passkey
+
+	// EncodedID is the passkey's ID encoded for forms and the browser.
+	EncodedID string
+}
+
+type passkeysForm struct {
+	Name string
+
+	// NonFieldErrors stores errors which do not relate to a form field.
+	NonFieldErrors []string
+	// FieldErrors stores errors relating to specific form fields.
+	FieldErrors map[string]string
+}
+
+// passkeysHandler lists the current user's passkeys and lets them add more.
+func (app *application) passkeysHandler(w http.ResponseWriter, r *http.Request) {
+	app.renderPasskeys(w, r, http.StatusOK, passkeysForm{})
+}
+
+func (app *application) renderPasskeys(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	form passkeysForm,
+) {
+	passkeys, err := app.passkeys.List(r.Context(), app.authenticated(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	challenge, err := app.newPasskeyChallenge(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The browser is told about the existing passkeys so it doesn't register
+	// an authenticator twice.
+	views := make([]passkeyView, len(passkeys))
+	exclude := make([]string, len(passkeys))
+	for i, p := range passkeys {
+		exclude[i] = webauthn.Encoding.EncodeToString(p.ID)
+		views[i] = passkeyView{Passkey: p, EncodedID: exclude[i]}
+	}
+
+	app.render(w, status, "passkeys.tmpl", passkeysPage{
+		Page: app.newPage(
+			r,
+			"Passkeys - Kudoer",
+			"Log in with your device instead of a password",
+		),
+		Passkeys:   views,
+		Challenge:  challenge,
+		Exclude:    exclude,
+		RPID:       app.relyingParty.RPID,
+		Algorithms: webauthn.Algorithms,
+		Form:       form,
+	})
+}
+
+// passkeysPostHandler registers a new passkey for the current user. Their
+// password is required so a stolen session can't be used to add a way to log
+// in.
+func (app *application) passkeysPostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 16384)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	challenge := app.sessionManager.PopBytes(r.Context(), "passkeyChallenge")
+	username := app.authenticated(r)
+	form := passkeysForm{Name: strings.TrimSpace(r.PostForm.Get("name"))}
+
+	v := validator.New()
+	v.PasskeyName(form.Name)
+	clientData, ok1 := passkeyField(r, "clientDataJSON")
+	attestation, ok2 := passkeyField(r, "attestationObject")
+	v.Check(ok1 && ok2, "passkey", "Your browser didn't create a passkey")
+
+	var valid bool
+	if form.NonFieldErrors, form.FieldErrors, valid = v.Valid(); !valid {
+		app.renderPasskeys(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	err = app.users.Authenticate(r.Context(), username, r.PostForm.Get("password"))
+	if errors.Is(err, models.ErrInvalidCredentials) {
+		v.AddFieldError("password", "Password is incorrect")
+		form.NonFieldErrors, form.FieldErrors, _ = v.Valid()
+		app.renderPasskeys(w, r, http.StatusUnprocessableEntity, form)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	cred, err := app.relyingParty.VerifyRegistration(challenge, clientData, attestation)
+	if errors.Is(err, webauthn.ErrVerification) {
+		app.infoLog.Println("failed passkey registration:", username, err)
+		v.AddFieldError("passkey", "Passkey could not be verified")
+		form.NonFieldErrors, form.FieldErrors, _ = v.Valid()
+		app.renderPasskeys(w, r, http.StatusUnprocessableEntity, form)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.passkeys.Insert(
+		r.Context(),
+		username,
+		form.Name,
+		cred.ID,
+		cred.PublicKey,
+		cred.SignCount,
+	)
+	if errors.Is(err, models.ErrPasskeyExists) {
+		v.AddFieldError("passkey", "That passkey is already registered")
+		form.NonFieldErrors, form.FieldErrors, _ = v.Valid()
+		app.renderPasskeys(w, r, http.StatusUnprocessableEntity, form)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.flash(r, "Passkey added")
+	http.Redirect(w, r, "/user/passkeys", http.StatusSeeOther)
+}
+
+// passkeysDeletePostHandler removes one of the current user's passkeys.
+func (app *application) passkeysDeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id, ok := passkeyField(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.passkeys.Delete(r.Context(), app.authenticated(r), id)
+	if errors.Is(err, models.ErrNoRecord) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.flash(r, "Passkey removed")
+	http.Redirect(w, r, "/user/passkeys", http.StatusSeeOther)
+}
@@ -3,7 +3,10 @@
 package application
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"git.sr.ht/~kota/kudoer/application/validator"
 	"git.sr.ht/~kota/kudoer/db/models"
@@ -28,6 +31,21 @@ type searchForm struct {
 func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
 	title := "Kudoer"
 	params := r.URL.Query()
+
+	// Pasting a link to a known item leads straight to that item.
+	if q := strings.TrimSpace(params.Get("q")); strings.HasPrefix(q, "http://") ||
+		strings.HasPrefix(q, "https://") {
+		source := validator.New().Source(q)
+		id, err := app.items.FindSource(r.Context(), source)
+		if err == nil {
+			http.Redirect(w, r, fmt.Sprintf("/item/view/%v", id), http.StatusSeeOther)
+			return
+		} else if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+	}
+
 	form := searchForm{
 		Query:       strip(params.Get("q")),
 		FieldErrors: map[string]string{},
@@ -56,7 +74,7 @@ func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
 	var users []models.SearchUser
 	switch params.Get("type") {
 	case "items":
-		i, err := app.search.Items(r.Context(), form.Query)
+		i, err := app.search.Items(r.Context(), form.Query, app.authenticated(r))
 		if err != nil {
 			app.serverError(w, err)
 			return
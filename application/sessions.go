@@ -0,0 +1,74 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package application
+
+import (
+	"errors"
+	"net/http"
+
+	"git.sr.ht/~kota/kudoer/db/litesession"
+)
+
+type userSessionsPage struct {
+	Page
+	Sessions []litesession.Session
+
+	// Current is the ID of the session viewing the page.
+	Current string
+}
+
+// userSessionsHandler lists the current user's active sessions.
+func (app *application) userSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.sessionStore.Sessions(r.Context(), app.authenticated(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, http.StatusOK, "userSessions.tmpl", userSessionsPage{
+		Page: app.newPage(
+			r,
+			"Sessions - Kudoer",
+			"Where you're logged in to Kudoer",
+		),
+		Sessions: sessions,
+		Current:  litesession.ID(app.sessionManager.Token(r.Context())),
+	})
+}
+
+// userSessionsRevokePostHandler logs out one of the current user's sessions.
+func (app *application) userSessionsRevokePostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Revoking the current session is the same as logging out. It can't be
+	// deleted from the store directly since it's saved again at the end of
+	// this request.
+	id := r.PostForm.Get("id")
+	if id == litesession.ID(app.sessionManager.Token(r.Context())) {
+		err = app.logout(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.flash(r, "You've been logged out successfully")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	err = app.sessionStore.Revoke(r.Context(), app.authenticated(r), id)
+	if errors.Is(err, litesession.ErrNoSession) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.flash(r, "Session logged out")
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
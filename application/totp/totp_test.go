@@ -0,0 +1,144 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// The shared secret used by the test vectors in RFC 4226 and RFC 6238.
+var rfcKey = []byte("12345678901234567890")
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 Appendix D.
+	want := []string{
+		"755224",
+		"287082",
+		"359152",
+		"969429",
+		"338314",
+		"254676",
+		"287922",
+		"162583",
+		"399871",
+		"520489",
+	}
+	for counter, code := range want {
+		got := hotp(rfcKey, uint64(counter), 6)
+		if got != code {
+			t.Fatalf("counter %d: got: %v want: %v\n", counter, got, code)
+		}
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 Appendix B, SHA1 mode.
+	type test struct {
+		time int64
+		want string
+	}
+
+	tests := []test{
+		{time: 59, want: "94287082"},
+		{time: 1111111109, want: "07081804"},
+		{time: 1111111111, want: "14050471"},
+		{time: 1234567890, want: "89005924"},
+		{time: 2000000000, want: "69279037"},
+		{time: 20000000000, want: "65353130"},
+	}
+
+	for _, tc := range tests {
+		step := Step(time.Unix(tc.time, 0))
+		got := hotp(rfcKey, uint64(step), 8)
+		if got != tc.want {
+			t.Fatalf("time %d: got: %v want: %v\n", tc.time, got, tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := encoding.EncodeToString(rfcKey)
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	code := func(step int64) string {
+		c, err := Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	type test struct {
+		description string
+		code        string
+		step        int64
+		valid       bool
+	}
+
+	tests := []test{
+		{
+			description: "Current step",
+			code:        code(step),
+			step:        step,
+			valid:       true,
+		},
+		{
+			description: "Previous step",
+			code:        code(step - 1),
+			step:        step - 1,
+			valid:       true,
+		},
+		{
+			description: "Next step",
+			code:        code(step + 1),
+			step:        step + 1,
+			valid:       true,
+		},
+		{
+			description: "Too old",
+			code:        code(step - 2),
+			valid:       false,
+		},
+		{
+			description: "Spaces",
+			code:        code(step)[:3] + " " + code(step)[3:],
+			step:        step,
+			valid:       true,
+		},
+		{
+			description: "Too short",
+			code:        code(step)[:5],
+			valid:       false,
+		},
+		{
+			description: "Blank",
+			code:        "",
+			valid:       false,
+		},
+	}
+
+	for _, tc := range tests {
+		got, valid := Validate(secret, tc.code, now)
+		if valid != tc.valid {
+			t.Fatalf("%v: got valid: %v want: %v\n", tc.description, valid, tc.valid)
+		}
+		if valid && got != tc.step {
+			t.Fatalf("%v: got step: %v want: %v\n", tc.description, got, tc.step)
+		}
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Fatalf("generated secret %v is invalid: %v\n", secret, err)
+	}
+
+	want := "otpauth://totp/Kudoer:alice?issuer=Kudoer&secret=" + secret
+	if got := URI("Kudoer", "alice", secret); got != want {
+		t.Fatalf("got: %v want: %v\n", got, want)
+	}
+}
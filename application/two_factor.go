@@ -0,0 +1,383 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package application
+
+import (
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.sr.ht/~kota/kudoer/application/totp"
+	"git.sr.ht/~kota/kudoer/application/validator"
+	"git.sr.ht/~kota/kudoer/db/models"
+	"github.com/skip2/go-qrcode"
+)
+
+// twoFactorWindow is how long a user has to enter their second factor after
+// entering their password.
+const twoFactorWindow = 5 * time.Minute
+
+type twoFactorPage struct {
+	Page
+	Enabled bool
+
+	// Left is how many recovery codes the user has left.
+	Left int
+
+	// The secret being enrolled and a QR code of it for authenticator apps.
+	Secret string
+	QRCode template.URL
+
+	Form twoFactorForm
+}
+
+type twoFactorForm struct {
+	// NonFieldErrors stores errors which do not relate to a form field.
+	NonFieldErrors []string
+	// FieldErrors stores errors relating to specific form fields.
+	FieldErrors map[string]string
+}
+
+// twoFactorHandler shows whether two-factor authentication is on. If it's off
+// a new secret is generated for the user to add to their authenticator app.
+func (app *application) twoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	app.renderTwoFactor(w, r, http.StatusOK, twoFactorForm{})
+}
+
+func (app *application) renderTwoFactor(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	form twoFactorForm,
+) {
+	username := app.authenticated(r)
+	secret, err := app.twoFactor.Secret(r.Context(), username)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	page := twoFactorPage{
+		Page: app.newPage(
+			r,
+			"Two-factor authentication - Kudoer",
+			"Protect your account with an authenticator app",
+		),
+		Enabled: secret != "",
+		Form:    form,
+	}
+
+	if page.Enabled {
+		page.Left, err = app.twoFactor.RecoveryCodesLeft(r.Context(), username)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.render(w, status, "twoFactor.tmpl", page)
+		return
+	}
+
+	// Keep the secret in the session until it's confirmed so reloading the
+	// page doesn't change it.
+	page.Secret = app.sessionManager.GetString(r.Context(), "totpSecret")
+	if page.Secret == "" {
+		page.Secret, err = totp.NewSecret()
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "totpSecret", page.Secret)
+	}
+
+	png, err := qrcode.Encode(
+		totp.URI("Kudoer", username, page.Secret),
+		qrcode.Medium,
+		256,
+	)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	page.QRCode = template.URL(
+		"data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	)
+	app.render(w, status, "twoFactor.tmpl", page)
+}
+
+type twoFactorCodesPage struct {
+	Page
+	Codes []string
+}
+
+// renderRecoveryCodes shows a user their new recovery codes. They are never
+// shown again.
+func (app *application) renderRecoveryCodes(
+	w http.ResponseWriter,
+	r *http.Request,
+	codes []string,
+) {
+	w.Header().Set("Cache-Control", "no-store")
+	app.render(w, http.StatusOK, "twoFactorCodes.tmpl", twoFactorCodesPage{
+		Page: app.newPage(
+			r,
+			"Recovery codes - Kudoer",
+			"Recovery codes for your account",
+		),
+		Codes: codes,
+	})
+}
+
+// twoFactorEnablePostHandler turns on two-factor authentication once the user
+// proves their authenticator app has the secret by entering a code from it.
+func (app *application) twoFactorEnablePostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	username := app.authenticated(r)
+	secret := app.sessionManager.GetString(r.Context(), "totpSecret")
+	if secret == "" {
+		http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+		return
+	}
+
+	v := validator.New()
+	step, ok := totp.Validate(secret, r.PostForm.Get("code"), time.Now())
+	v.Check(ok, "code", "Code is incorrect")
+
+	var form twoFactorForm
+	var valid bool
+	if form.NonFieldErrors, form.FieldErrors, valid = v.Valid(); !valid {
+		app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	codes, err := app.twoFactor.Enable(r.Context(), username, secret, step)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "totpSecret")
+
+	app.flash(r, "Two-factor authentication is on")
+	app.renderRecoveryCodes(w, r, codes)
+}
+
+// twoFactorPassword checks the current user's password for changes to their
+// two-factor authentication, rendering an error if it's wrong. It reports if
+// the password was correct.
+func (app *application) twoFactorPassword(
+	w http.ResponseWriter,
+	r *http.Request,
+) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return false
+	}
+
+	err = app.users.Authenticate(
+		r.Context(),
+		app.authenticated(r),
+		r.PostForm.Get("password"),
+	)
+	if errors.Is(err, models.ErrInvalidCredentials) {
+		v := validator.New()
+		v.AddFieldError("password", "Password is incorrect")
+		var form twoFactorForm
+		form.NonFieldErrors, form.FieldErrors, _ = v.Valid()
+		app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, form)
+		return false
+	} else if err != nil {
+		app.serverError(w, err)
+		return false
+	}
+	return true
+}
+
+// twoFactorDisablePostHandler turns off two-factor authentication.
+func (app *application) twoFactorDisablePostHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.twoFactorPassword(w, r) {
+		return
+	}
+
+	err := app.twoFactor.Disable(r.Context(), app.authenticated(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.flash(r, "Two-factor authentication is off")
+	http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+}
+
+// twoFactorRecoveryPostHandler replaces the current user's recovery codes.
+func (app *application) twoFactorRecoveryPostHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.twoFactorPassword(w, r) {
+		return
+	}
+
+	codes, err := app.twoFactor.RegenerateRecoveryCodes(
+		r.Context(),
+		app.authenticated(r),
+	)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.renderRecoveryCodes(w, r, codes)
+}
+
+// startTwoFactor records that a user entered their password but still needs
+// to enter their second factor.
+func (app *application) startTwoFactor(
+	r *http.Request,
+	username string,
+	rememberMe bool,
+) error {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+	app.sessionManager.Put(r.Context(), "twoFactorUsername", username)
+	app.sessionManager.Put(r.Context(), "twoFactorRemember", rememberMe)
+	app.sessionManager.Put(r.Context(), "twoFactorStarted", time.Now().Unix())
+	return nil
+}
+
+// twoFactorPending returns the user who entered their password in this
+// session and is waiting to enter their second factor, or a blank string.
+func (app *application) twoFactorPending(r *http.Request) string {
+	started := app.sessionManager.GetInt64(r.Context(), "twoFactorStarted")
+	if time.Since(time.Unix(started, 0)) > twoFactorWindow {
+		return ""
+	}
+	return app.sessionManager.GetString(r.Context(), "twoFactorUsername")
+}
+
+type loginTwoFactorPage struct {
+	Page
+	Form twoFactorForm
+}
+
+// loginTwoFactorHandler asks a user for their second factor after they
+// entered their password.
+func (app *application) loginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if app.twoFactorPending(r) == "" {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	app.renderLoginTwoFactor(w, r, http.StatusOK, twoFactorForm{})
+}
+
+// renderLoginTwoFactor renders the page asking for a second factor.
+func (app *application) renderLoginTwoFactor(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	form twoFactorForm,
+) {
+	app.render(w, status, "loginTwoFactor.tmpl", loginTwoFactorPage{
+		Page: app.newPage(
+			r,
+			"Login on Kudoer",
+			"Enter the code from your authenticator app",
+		),
+		Form: form,
+	})
+}
+
+// loginTwoFactorPostHandler finishes logging a user in once they enter a code
+// from their authenticator app or one of their recovery codes.
+func (app *application) loginTwoFactorPostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	username := app.twoFactorPending(r)
+	if username == "" {
+		app.flash(r, "Your login expired, please try again")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	// Wrong codes count as failed logins too, otherwise someone who knows the
+	// password could guess codes forever.
+	blocked, err := app.reserveLogin(r.Context(), username)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if blocked != "" {
+		v := validator.New()
+		v.AddNonFieldError(blocked)
+		var form twoFactorForm
+		form.NonFieldErrors, form.FieldErrors, _ = v.Valid()
+		app.renderLoginTwoFactor(w, r, http.StatusTooManyRequests, form)
+		return
+	}
+	defer app.releaseLogin(r.Context(), username)
+
+	secret, err := app.twoFactor.Secret(r.Context(), username)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Codes from the authenticator app are all digits, anything else is
+	// treated as a recovery code.
+	code := strings.TrimSpace(r.PostForm.Get("code"))
+	if step, ok := totp.Validate(secret, code, time.Now()); ok {
+		err = app.twoFactor.UseStep(r.Context(), username, step)
+	} else if strings.Trim(strings.ReplaceAll(code, " ", ""), "0123456789") == "" {
+		err = models.ErrInvalidCredentials
+	} else {
+		err = app.twoFactor.UseRecoveryCode(r.Context(), username, code)
+	}
+	if errors.Is(err, models.ErrInvalidCredentials) {
+		err = app.loginFailed(r.Context(), username)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		v := validator.New()
+		v.AddFieldError("code", "Code is incorrect")
+		var form twoFactorForm
+		form.NonFieldErrors, form.FieldErrors, _ = v.Valid()
+		app.renderLoginTwoFactor(w, r, http.StatusUnprocessableEntity, form)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.loginAttempts.Succeeded(r.Context(), username)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	rememberMe := app.sessionManager.GetBool(r.Context(), "twoFactorRemember")
+	app.sessionManager.Remove(r.Context(), "twoFactorUsername")
+	app.sessionManager.Remove(r.Context(), "twoFactorRemember")
+	app.sessionManager.Remove(r.Context(), "twoFactorStarted")
+
+	err = app.login(r, username, rememberMe)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -3,14 +3,16 @@
 package application
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"git.sr.ht/~kota/kudoer/application/validator"
 	"git.sr.ht/~kota/kudoer/db/models"
-	"golang.org/x/crypto/bcrypt"
+	"git.sr.ht/~kota/kudoer/db/passwd"
 )
 
 type userViewPage struct {
@@ -53,7 +55,7 @@ func (app *application) userViewHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	kudos, err := app.kudos.User(r.Context(), username, page)
+	kudos, err := app.kudos.User(r.Context(), username, app.authenticated(r), page)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -142,10 +144,7 @@ func (app *application) userRegisterPostHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword(
-		[]byte(password),
-		bcrypt.DefaultCost,
-	)
+	hashedPassword, err := passwd.Hash(password)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -156,7 +155,7 @@ func (app *application) userRegisterPostHandler(w http.ResponseWriter, r *http.R
 		form.Username,
 		form.DisplayName,
 		form.Email,
-		string(hashedPassword),
+		hashedPassword,
 	)
 	if errors.Is(err, models.ErrUsernameExists) {
 		v.AddFieldError("username", "Username is already taken")
@@ -170,22 +169,53 @@ func (app *application) userRegisterPostHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if form.Email != "" {
+		err = app.sendVerification(r.Context(), form.Username, form.Email)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.flash(r, "Check your email to verify your address")
+	}
+
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
 type userLoginPage struct {
 	Page
 	Form userLoginForm
+
+	// The options for logging in with a passkey instead of a password.
+	Challenge string
+	RPID      string
 }
 
 func (app *application) userLoginHandler(w http.ResponseWriter, r *http.Request) {
-	app.render(w, http.StatusOK, "login.tmpl", userLoginPage{
+	app.renderLogin(w, r, http.StatusOK, userLoginForm{})
+}
+
+// renderLogin renders the login page with a new challenge for logging in with
+// a passkey.
+func (app *application) renderLogin(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	form userLoginForm,
+) {
+	challenge, err := app.newPasskeyChallenge(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.render(w, status, "login.tmpl", userLoginPage{
 		Page: app.newPage(
 			r,
 			"Login on Kudoer",
 			"Provide your login details to access Kudoer",
 		),
-		Form: userLoginForm{},
+		Form:      form,
+		Challenge: challenge,
+		RPID:      app.relyingParty.RPID,
 	})
 }
 
@@ -218,14 +248,7 @@ func (app *application) userLoginPostHandler(w http.ResponseWriter, r *http.Requ
 	v.Username(form.Username)
 
 	validationError := func() {
-		app.render(w, http.StatusUnprocessableEntity, "login.tmpl", userLoginPage{
-			Page: app.newPage(
-				r,
-				"Login on Kudoer",
-				"Provide your login details to access Kudoer",
-			),
-			Form: form,
-		})
+		app.renderLogin(w, r, http.StatusUnprocessableEntity, form)
 	}
 	var valid bool
 	if form.NonFieldErrors, form.FieldErrors, valid = v.Valid(); !valid {
@@ -233,10 +256,31 @@ func (app *application) userLoginPostHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Logins are slowed down and eventually locked after failing to stop
+	// passwords from being guessed. The password isn't checked at all while
+	// waiting so a correct guess can't be noticed.
+	blocked, err := app.reserveLogin(r.Context(), form.Username)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if blocked != "" {
+		v.AddNonFieldError(blocked)
+		form.NonFieldErrors = v.NonFieldErrors
+		app.renderLogin(w, r, http.StatusTooManyRequests, form)
+		return
+	}
+	defer app.releaseLogin(r.Context(), form.Username)
+
 	password := r.PostForm.Get("password")
 	err = app.users.Authenticate(r.Context(), form.Username, password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
+			err = app.loginFailed(r.Context(), form.Username)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
 			v.AddNonFieldError("Username or password is incorrect")
 			form.NonFieldErrors = v.NonFieldErrors
 			validationError()
@@ -246,6 +290,28 @@ func (app *application) userLoginPostHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Users with two-factor authentication need to enter a code before they
+	// are logged in.
+	secret, err := app.twoFactor.Secret(r.Context(), form.Username)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if secret != "" {
+		err = app.startTwoFactor(r, form.Username, form.RememberMe)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	err = app.loginAttempts.Succeeded(r.Context(), form.Username)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 	err = app.login(r, form.Username, form.RememberMe)
 	if err != nil {
 		app.serverError(w, err)
@@ -312,7 +378,13 @@ func (app *application) userForgotPostHandler(w http.ResponseWriter, r *http.Req
 		})
 	}
 
-	email, err := app.users.GetEmail(r.Context(), form.Username)
+	// Resets are only sent to verified addresses, otherwise anyone could take
+	// over an account by adding their own email to it.
+	email, err := app.users.VerifiedEmail(r.Context(), form.Username)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 	flashMsg := "If that email is in our system for your user instructions will be sent shortly"
 	if email == "" {
 		// Lie about it to prevent attackers from being able to "confirm" a
@@ -328,20 +400,16 @@ func (app *application) userForgotPostHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	go func() {
-		defer func() {
-			if err := recover(); err != nil {
-				app.errLog.Println(err)
-			}
-		}()
-
-		// Emails can be case sensitive; so we use the stored email rather than
-		// the given email.
-		err = app.mailer.PasswordReset(email, token)
-		if err != nil {
-			app.errLog.Println(err)
-		}
-	}()
+	// Emails can be case sensitive; so we use the stored email rather than the
+	// given email.
+	err = app.mailer.Send(r.Context(), email, "reset", resetEmail{
+		Token:  token,
+		Expiry: time.Now().Add(models.PWResetTTL),
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
 	app.flash(r, flashMsg)
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -418,15 +486,12 @@ func (app *application) userResetPostHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword(
-		[]byte(password),
-		bcrypt.DefaultCost,
-	)
+	hashedPassword, err := passwd.Hash(password)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
-	err = app.users.ChangePassword(r.Context(), username, string(hashedPassword))
+	err = app.users.ChangePassword(r.Context(), username, hashedPassword)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -458,8 +523,8 @@ func (app *application) userLogoutPostHandler(w http.ResponseWriter, r *http.Req
 
 type userSettingsPage struct {
 	Page
-	Username string
-	Form     userSettingsForm
+	models.User
+	Form userSettingsForm
 }
 
 func (app *application) userSettingsHandler(w http.ResponseWriter, r *http.Request) {
@@ -470,10 +535,24 @@ func (app *application) userSettingsHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	digest, err := app.digests.Frequency(r.Context(), username)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Show the address the user last asked for, so saving other settings
+	// doesn't cancel a pending change.
+	email := user.Email
+	if user.PendingEmail != "" {
+		email = user.PendingEmail
+	}
+
 	form := userSettingsForm{
 		DisplayName: user.DisplayName,
-		Email:       user.Email,
+		Email:       email,
 		Bio:         user.Bio,
+		Digest:      int(digest),
 	}
 
 	app.render(w, http.StatusOK, "userSettings.tmpl", userSettingsPage{
@@ -482,8 +561,8 @@ func (app *application) userSettingsHandler(w http.ResponseWriter, r *http.Reque
 			"Editing your profile",
 			"Change your profile settings",
 		),
-		Username: user.Username,
-		Form:     form,
+		User: user,
+		Form: form,
 	})
 }
 
@@ -491,6 +570,7 @@ type userSettingsForm struct {
 	DisplayName string
 	Email       string
 	Bio         string
+	Digest      int
 
 	// NonFieldErrors stores errors which do not relate to a form field.
 	NonFieldErrors []string
@@ -548,17 +628,23 @@ func (app *application) userSettingsPostHandler(w http.ResponseWriter, r *http.R
 	v.Optional(form.DisplayName, v.DisplayName)
 	v.Optional(form.Email, v.Email)
 	v.Optional(form.Bio, v.Bio)
+	form.Digest = v.Digest(r.PostForm.Get("digest"))
 
 	var valid bool
 	if form.NonFieldErrors, form.FieldErrors, valid = v.Valid(); !valid {
+		user, err := app.users.Info(r.Context(), username)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
 		app.render(w, http.StatusUnprocessableEntity, "userSettings.tmpl", userSettingsPage{
 			Page: app.newPage(
 				r,
 				"Editing your profile",
 				"Change your profile settings",
 			),
-			Username: username,
-			Form:     form,
+			User: user,
+			Form: form,
 		})
 		return
 	}
@@ -567,7 +653,6 @@ func (app *application) userSettingsPostHandler(w http.ResponseWriter, r *http.R
 		r.Context(),
 		username,
 		form.DisplayName,
-		form.Email,
 		form.Bio,
 	)
 	if err != nil {
@@ -575,6 +660,30 @@ func (app *application) userSettingsPostHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	verify, err := app.users.ChangeEmail(r.Context(), username, form.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if verify != "" {
+		err = app.sendVerification(r.Context(), username, verify)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.flash(r, "Check your email to verify your new address")
+	}
+
+	err = app.digests.Subscribe(
+		r.Context(),
+		username,
+		models.DigestFrequency(form.Digest),
+	)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	http.Redirect(w, r, fmt.Sprintf("/user/view/%v", username), http.StatusSeeOther)
 }
 
@@ -683,3 +792,117 @@ func (app *application) userUnfollowPostHandler(w http.ResponseWriter, r *http.R
 	app.flash(r, "You're no longer following "+toFollow)
 	http.Redirect(w, r, fmt.Sprintf("/user/view/%v", toFollow), http.StatusSeeOther)
 }
+
+// resetEmail is the data given to the password reset templates.
+type resetEmail struct {
+	Token  string
+	Expiry time.Time
+}
+
+// Expires is when the reset token stops working.
+func (e resetEmail) Expires() time.Time {
+	return e.Expiry
+}
+
+// verifyEmail is the data given to the email verification templates.
+type verifyEmail struct {
+	Email  string
+	Token  string
+	Expiry time.Time
+}
+
+// Expires is when the verification token stops working.
+func (e verifyEmail) Expires() time.Time {
+	return e.Expiry
+}
+
+// sendVerification sends a link to an email address which proves the user
+// owns it when followed.
+func (app *application) sendVerification(
+	ctx context.Context,
+	username string,
+	email string,
+) error {
+	token, err := app.verifications.New(ctx, username, email)
+	if err != nil {
+		return err
+	}
+	return app.mailer.Send(ctx, email, "verify", verifyEmail{
+		Email:  email,
+		Token:  token,
+		Expiry: time.Now().Add(models.VerificationTTL),
+	})
+}
+
+type userVerifyPage struct {
+	Page
+	Token string
+}
+
+// userVerifyHandler asks the user to confirm their email address. Following
+// the link must not verify it by itself since mail scanners open every link
+// in an email.
+func (app *application) userVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	app.render(w, http.StatusOK, "userVerify.tmpl", userVerifyPage{
+		Page: app.newPage(
+			r,
+			"Verify your email - Kudoer",
+			"Confirm your email address on Kudoer",
+		),
+		Token: r.URL.Query().Get("token"),
+	})
+}
+
+// userVerifyPostHandler marks the address a verification token was sent to as
+// verified.
+func (app *application) userVerifyPostHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	_, err = app.verifications.Verify(r.Context(), r.PostForm.Get("token"))
+	if errors.Is(err, models.ErrVerificationTokenInvalid) {
+		app.flash(r, "That verification link has expired. You can send a new one from your settings.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.flash(r, "Your email has been verified")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// userVerifyResendPostHandler sends a new verification link for the current
+// user's unverified or pending address.
+func (app *application) userVerifyResendPostHandler(w http.ResponseWriter, r *http.Request) {
+	username := app.authenticated(r)
+	user, err := app.users.Info(r.Context(), username)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	email := user.PendingEmail
+	if email == "" && !user.EmailVerified {
+		email = user.Email
+	}
+	if email == "" {
+		app.flash(r, "There's no email waiting to be verified")
+		http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+		return
+	}
+
+	err = app.sendVerification(r.Context(), username, email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.flash(r, "Verification email sent to "+email)
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
@@ -3,15 +3,20 @@
 package validator
 
 import (
+	"net"
+	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 	"unicode/utf8"
 
 	emojis "git.sr.ht/~kota/kudoer/application/emoji"
 	"git.sr.ht/~kota/kudoer/application/frames"
+	"git.sr.ht/~kota/kudoer/application/kinds"
 )
 
 var rxUsername = regexp.MustCompile("^[a-z0-9_-]+$")
+var rxMention = regexp.MustCompile(`(?:^|[\s(*_>])@([a-z0-9_-]+)`)
 var rxEmail = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
 type Validator struct {
@@ -113,11 +118,6 @@ func (v *Validator) DisplayName(displayname string) {
 // checking if a password is _able to be used at all_.
 func (v *Validator) Password(password, confirmation string) {
 	v.Check(password != "", "password", "Password cannot be blank")
-	v.Check(
-		len(password) <= 72,
-		"password",
-		"Password cannot be larger than 72 bytes as a limitation of bcrypt",
-	)
 	v.Check(
 		password == confirmation,
 		"password",
@@ -155,10 +155,168 @@ func (v *Validator) ItemDescription(desc string) {
 	)
 }
 
+// trackingParams are URL query parameters which only exist to track users.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"ref_src": true,
+	"si":      true,
+}
+
+// Source runs validation on an item's source URL.
+// Only http and https URLs are allowed. The URL is returned in a normalized
+// form with a lowercase host and without tracking parameters.
+func (v *Validator) Source(source string) string {
+	source = strings.TrimSpace(source)
+	v.Check(
+		utf8.RuneCountInString(source) <= 2000,
+		"source",
+		"Source cannot be longer than 2000 characters",
+	)
+
+	u, err := url.Parse(source)
+	if err != nil {
+		v.AddFieldError("source", "Source must be a valid URL")
+		return source
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	v.Check(
+		u.Scheme == "http" || u.Scheme == "https",
+		"source",
+		"Source must be an http or https URL",
+	)
+	v.Check(u.Host != "", "source", "Source must include a domain")
+	v.Check(
+		u.User == nil,
+		"source",
+		"Source cannot contain a username or password",
+	)
+
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") ||
+		(u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]" // IPv6 literal.
+	} else {
+		u.Host = host
+	}
+
+	query := u.Query()
+	for key := range query {
+		if trackingParams[strings.ToLower(key)] ||
+			strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+// ItemKind runs validation on an item's kind.
+func (v *Validator) ItemKind(kind string) {
+	v.Check(kinds.Validate(kind), "kind", "Invalid item kind selected")
+}
+
+// ItemAttributes runs validation on the attributes for an item's kind.
+// Errors are added to an "attr-" field named after the attribute's key.
+// Attributes which are blank or do not belong to the kind are dropped and the
+// remaining values are returned in a normalized form.
+func (v *Validator) ItemAttributes(
+	kind string,
+	attrs map[string]string,
+) map[string]string {
+	normalized := make(map[string]string)
+	for _, a := range kinds.Get(kind).Attributes {
+		value := strings.TrimSpace(attrs[a.Key])
+		if value == "" {
+			continue
+		}
+
+		field := "attr-" + a.Key
+		switch a.Type {
+		case kinds.Year:
+			year, err := strconv.Atoi(value)
+			v.Check(
+				err == nil && year > 0 && year < 10000,
+				field,
+				a.Label+" must be a year such as 1999",
+			)
+		case kinds.ISBN:
+			value = strings.ToUpper(strings.NewReplacer(
+				"-", "",
+				" ", "",
+			).Replace(value))
+			v.Check(validISBN(value), field, a.Label+" is not a valid ISBN")
+		default:
+			v.Check(
+				utf8.RuneCountInString(value) <= 200,
+				field,
+				a.Label+" cannot be longer than 200 characters",
+			)
+		}
+		normalized[a.Key] = value
+	}
+	return normalized
+}
+
+// validISBN checks the length and check digit of an ISBN-10 or ISBN-13 without
+// any separators.
+func validISBN(isbn string) bool {
+	switch len(isbn) {
+	case 10:
+		var sum int
+		for i, r := range isbn {
+			var d int
+			switch {
+			case '0' <= r && r <= '9':
+				d = int(r - '0')
+			case r == 'X' && i == 9:
+				d = 10
+			default:
+				return false
+			}
+			sum += d * (10 - i)
+		}
+		return sum%11 == 0
+	case 13:
+		var sum int
+		for i, r := range isbn {
+			if r < '0' || r > '9' {
+				return false
+			}
+			d := int(r - '0')
+			if i%2 == 1 {
+				d *= 3
+			}
+			sum += d
+		}
+		return sum%10 == 0
+	}
+	return false
+}
+
 // Kudo runs validation on all the kudo fields.
 // If an error is found it is added as a "kudo" field error.
 // Parsed fields are returned.
-func (v *Validator) Kudo(emoji, frame, body string) (int, int, string) {
+func (v *Validator) Kudo(
+	emoji, frame, body, warning string,
+) (int, int, string, string) {
 	e, err := strconv.Atoi(emoji)
 	if err != nil {
 		v.AddFieldError("kudo", "Invalid emoji payload")
@@ -176,5 +334,88 @@ func (v *Validator) Kudo(emoji, frame, body string) (int, int, string) {
 		"kudo",
 		"Body of kudo cannot be longer than 5000 characters",
 	)
-	return e, f, body
+
+	warning = strings.TrimSpace(warning)
+	v.Check(
+		utf8.RuneCountInString(warning) <= 100,
+		"kudo",
+		"Content warning cannot be longer than 100 characters",
+	)
+	v.Check(
+		!strings.ContainsAny(warning, "\r\n"),
+		"kudo",
+		"Content warning cannot contain line breaks",
+	)
+	v.Check(
+		warning == "" || strings.TrimSpace(body) != "",
+		"kudo",
+		"A content warning needs a body to hide",
+	)
+	return e, f, body, warning
+}
+
+// Mentions returns each distinct username mentioned with an @username in a
+// body of text. Nothing is checked about whether the users exist.
+func Mentions(body string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, m := range rxMention.FindAllStringSubmatch(body, -1) {
+		username := m[1]
+		if seen[username] || utf8.RuneCountInString(username) > 30 {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// Visibility runs validation on who may see a kudo and returns the level.
+// A blank value means the kudo is public.
+func (v *Validator) Visibility(visibility string) int {
+	if visibility == "" {
+		return 0
+	}
+	level, err := strconv.Atoi(visibility)
+	v.Check(
+		err == nil && level >= 0 && level <= 2,
+		"kudo",
+		"Invalid visibility selected",
+	)
+	return level
+}
+
+// Digest runs validation on how often a user wants an email digest and
+// returns the frequency. A blank value means never.
+func (v *Validator) Digest(digest string) int {
+	if digest == "" {
+		return 0
+	}
+	frequency, err := strconv.Atoi(digest)
+	v.Check(
+		err == nil && frequency >= 0 && frequency <= 2,
+		"digest",
+		"Invalid digest frequency selected",
+	)
+	return frequency
+}
+
+// Reply runs validation on the body of a reply to a kudo.
+func (v *Validator) Reply(body string) {
+	v.Check(strings.TrimSpace(body) != "", "reply", "Reply cannot be blank")
+	v.Check(
+		utf8.RuneCountInString(body) <= 2000,
+		"reply",
+		"Reply cannot be longer than 2000 characters",
+	)
+}
+
+// PasskeyName runs validation on the name a user gives one of their passkeys.
+func (v *Validator) PasskeyName(name string) {
+	v.Check(strings.TrimSpace(name) != "", "name", "Name cannot be blank")
+	v.Check(
+		utf8.RuneCountInString(name) <= 50,
+		"name",
+		"Name cannot be longer than 50 characters",
+	)
 }
@@ -1,6 +1,8 @@
 package validator
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -215,11 +217,18 @@ func TestPassword(t *testing.T) {
 			errMsg:       "Password and confirmation do not match",
 		},
 		{
-			description:  "Too long Password",
+			description:  "Longer than bcrypt allowed",
 			input:        "1234567890123456789012345678901234567890123456789012345678901234567890123",
 			confirmation: "1234567890123456789012345678901234567890123456789012345678901234567890123",
+			valid:        true,
+			errMsg:       "",
+		},
+		{
+			description:  "Blank",
+			input:        "",
+			confirmation: "",
 			valid:        false,
-			errMsg:       "Password cannot be larger than 72 bytes as a limitation of bcrypt",
+			errMsg:       "Password cannot be blank",
 		},
 	}
 
@@ -423,3 +432,632 @@ func TestItemDescription(t *testing.T) {
 		}
 	}
 }
+
+func TestItemAttributes(t *testing.T) {
+	type test struct {
+		description string
+		kind        string
+		input       map[string]string
+		want        map[string]string
+		valid       bool
+		errMsg      string
+	}
+
+	tests := []test{
+		{
+			description: "Basic valid book",
+			kind:        "book",
+			input: map[string]string{
+				"author": " Ursula K. Le Guin ",
+				"isbn":   "978-0-441-47812-5",
+				"year":   "1969",
+			},
+			want: map[string]string{
+				"author": "Ursula K. Le Guin",
+				"isbn":   "9780441478125",
+				"year":   "1969",
+			},
+			valid:  true,
+			errMsg: "",
+		},
+		{
+			description: "ISBN-10 with check character",
+			kind:        "book",
+			input:       map[string]string{"isbn": "0-8044-2957-x"},
+			want:        map[string]string{"isbn": "080442957X"},
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Blank and unknown attributes are dropped",
+			kind:        "place",
+			input:       map[string]string{"address": "", "director": "Agnès Varda"},
+			want:        map[string]string{},
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Bad check digit",
+			kind:        "book",
+			input:       map[string]string{"isbn": "9780441478120"},
+			want:        map[string]string{"isbn": "9780441478120"},
+			valid:       false,
+			errMsg:      "ISBN is not a valid ISBN",
+		},
+		{
+			description: "Invalid year",
+			kind:        "film",
+			input:       map[string]string{"year": "last year"},
+			want:        map[string]string{"year": "last year"},
+			valid:       false,
+			errMsg:      "Year must be a year such as 1999",
+		},
+	}
+
+	for _, tc := range tests {
+		v := New()
+		got := v.ItemAttributes(tc.kind, tc.input)
+		_, _, valid := v.Valid()
+
+		var errMsg string
+		if !valid {
+			for _, e := range v.FieldErrors {
+				errMsg = e
+				break
+			}
+		}
+
+		if valid != tc.valid {
+			t.Fatalf(
+				"%v: got: \"%v\" want: \"%v\" msg: \"%v\"\n",
+				tc.description,
+				valid,
+				tc.valid,
+				errMsg,
+			)
+		}
+		if errMsg != tc.errMsg {
+			t.Fatalf(
+				"%v: msg: \"%v\" wanted msg: \"%v\"\n",
+				tc.description,
+				errMsg,
+				tc.errMsg,
+			)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf(
+				"%v: got: \"%v\" want: \"%v\"\n",
+				tc.description,
+				got,
+				tc.want,
+			)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	type test struct {
+		description string
+		input       string
+		want        string
+		valid       bool
+		errMsg      string
+	}
+
+	tests := []test{
+		{
+			description: "Basic valid source",
+			input:       "https://en.wikipedia.org/wiki/Dune_(novel)",
+			want:        "https://en.wikipedia.org/wiki/Dune_(novel)",
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Normalized host and tracking parameters",
+			input:       " HTTPS://Example.COM:443/film?id=7&utm_source=feed&fbclid=abc ",
+			want:        "https://example.com/film?id=7",
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Only tracking parameters",
+			input:       "http://example.com/?utm_medium=email",
+			want:        "http://example.com/",
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "IPv6 host with port",
+			input:       "http://[::1]:8080/x",
+			want:        "http://[::1]:8080/x",
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "IPv6 host with default port",
+			input:       "https://[2001:DB8::1]:443/x",
+			want:        "https://[2001:db8::1]/x",
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Other scheme",
+			input:       "javascript:alert(1)",
+			want:        "javascript:alert(1)",
+			valid:       false,
+			errMsg:      "Source must be an http or https URL",
+		},
+		{
+			description: "Missing domain",
+			input:       "https:///path",
+			want:        "https:///path",
+			valid:       false,
+			errMsg:      "Source must include a domain",
+		},
+	}
+
+	for _, tc := range tests {
+		v := New()
+		got := v.Source(tc.input)
+		_, _, valid := v.Valid()
+
+		var errMsg string
+		if !valid {
+			for _, e := range v.FieldErrors {
+				errMsg = e
+				break
+			}
+		}
+
+		if valid != tc.valid {
+			t.Fatalf(
+				"%v: got: \"%v\" want: \"%v\" msg: \"%v\"\n",
+				tc.description,
+				valid,
+				tc.valid,
+				errMsg,
+			)
+		}
+		if errMsg != tc.errMsg {
+			t.Fatalf(
+				"%v: msg: \"%v\" wanted msg: \"%v\"\n",
+				tc.description,
+				errMsg,
+				tc.errMsg,
+			)
+		}
+		if got != tc.want {
+			t.Fatalf(
+				"%v: got: \"%v\" want: \"%v\"\n",
+				tc.description,
+				got,
+				tc.want,
+			)
+		}
+	}
+}
+
+func TestKudoWarning(t *testing.T) {
+	type test struct {
+		description string
+		body        string
+		warning     string
+		want        string
+		valid       bool
+		errMsg      string
+	}
+
+	tests := []test{
+		{
+			description: "No warning",
+			body:        "Great ending.",
+			warning:     "",
+			want:        "",
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Warning is trimmed",
+			body:        "The butler did it.",
+			warning:     "  Spoilers for the ending ",
+			want:        "Spoilers for the ending",
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Too long",
+			body:        "The butler did it.",
+			warning:     strings.Repeat("ü", 101),
+			valid:       false,
+			errMsg:      "Content warning cannot be longer than 100 characters",
+		},
+		{
+			description: "Line break",
+			body:        "The butler did it.",
+			warning:     "Spoilers\nfor everything",
+			valid:       false,
+			errMsg:      "Content warning cannot contain line breaks",
+		},
+		{
+			description: "Nothing to hide",
+			body:        " ",
+			warning:     "Spoilers",
+			valid:       false,
+			errMsg:      "A content warning needs a body to hide",
+		},
+	}
+
+	for _, tc := range tests {
+		v := New()
+		_, _, _, got := v.Kudo("0", "0", tc.body, tc.warning)
+		_, _, valid := v.Valid()
+
+		var errMsg string
+		if !valid {
+			for _, e := range v.FieldErrors {
+				errMsg = e
+				break
+			}
+		}
+
+		if valid != tc.valid {
+			t.Fatalf(
+				"%v: got: \"%v\" want: \"%v\" wantErr \"%v\"\n",
+				tc.description,
+				valid,
+				tc.valid,
+				tc.errMsg,
+			)
+		}
+		if errMsg != tc.errMsg {
+			t.Fatalf(
+				"%v: msg: \"%v\" wanted msg: \"%v\"\n",
+				tc.description,
+				errMsg,
+				tc.errMsg,
+			)
+		}
+		if valid && got != tc.want {
+			t.Fatalf("%v: got: %q want: %q\n", tc.description, got, tc.want)
+		}
+	}
+}
+
+func TestReply(t *testing.T) {
+	type test struct {
+		description string
+		input       string
+		valid       bool
+		errMsg      string
+	}
+
+	tests := []test{
+		{
+			description: "Basic valid reply",
+			input:       "I loved this one too!",
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Blank",
+			input:       "",
+			valid:       false,
+			errMsg:      "Reply cannot be blank",
+		},
+		{
+			description: "Only whitespace",
+			input:       " \n\t",
+			valid:       false,
+			errMsg:      "Reply cannot be blank",
+		},
+		{
+			description: "Too long",
+			input:       strings.Repeat("ü", 2001),
+			valid:       false,
+			errMsg:      "Reply cannot be longer than 2000 characters",
+		},
+	}
+
+	for _, tc := range tests {
+		v := New()
+		v.Reply(tc.input)
+		_, _, valid := v.Valid()
+
+		var errMsg string
+		if !valid {
+			for _, e := range v.FieldErrors {
+				errMsg = e
+				break
+			}
+		}
+
+		if valid != tc.valid {
+			t.Fatalf(
+				"%v: got: \"%v\" want: \"%v\" wantErr \"%v\"\n",
+				tc.description,
+				valid,
+				tc.valid,
+				tc.errMsg,
+			)
+		}
+		if errMsg != tc.errMsg {
+			t.Fatalf(
+				"%v: msg: \"%v\" wanted msg: \"%v\"\n",
+				tc.description,
+				errMsg,
+				tc.errMsg,
+			)
+		}
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	type test struct {
+		description string
+		input       string
+		want        int
+		valid       bool
+		errMsg      string
+	}
+
+	tests := []test{
+		{
+			description: "Blank is public",
+			input:       "",
+			want:        0,
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Followers only",
+			input:       "1",
+			want:        1,
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Private",
+			input:       "2",
+			want:        2,
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Unknown level",
+			input:       "3",
+			valid:       false,
+			errMsg:      "Invalid visibility selected",
+		},
+		{
+			description: "Negative",
+			input:       "-1",
+			valid:       false,
+			errMsg:      "Invalid visibility selected",
+		},
+		{
+			description: "Not a number",
+			input:       "public",
+			valid:       false,
+			errMsg:      "Invalid visibility selected",
+		},
+	}
+
+	for _, tc := range tests {
+		v := New()
+		got := v.Visibility(tc.input)
+		_, _, valid := v.Valid()
+
+		var errMsg string
+		if !valid {
+			for _, e := range v.FieldErrors {
+				errMsg = e
+				break
+			}
+		}
+
+		if valid != tc.valid {
+			t.Fatalf(
+				"%v: got: \"%v\" want: \"%v\" wantErr \"%v\"\n",
+				tc.description,
+				valid,
+				tc.valid,
+				tc.errMsg,
+			)
+		}
+		if errMsg != tc.errMsg {
+			t.Fatalf(
+				"%v: msg: \"%v\" wanted msg: \"%v\"\n",
+				tc.description,
+				errMsg,
+				tc.errMsg,
+			)
+		}
+		if valid && got != tc.want {
+			t.Fatalf("%v: got: %v want: %v\n", tc.description, got, tc.want)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	type test struct {
+		description string
+		input       string
+		want        []string
+	}
+
+	tests := []test{
+		{
+			description: "No mentions",
+			input:       "A lovely film.",
+			want:        nil,
+		},
+		{
+			description: "Several mentions",
+			input:       "@kota and @ana_b saw it with me (@j-j).",
+			want:        []string{"kota", "ana_b", "j-j"},
+		},
+		{
+			description: "Repeated mention",
+			input:       "@kota @kota",
+			want:        []string{"kota"},
+		},
+		{
+			description: "Email address",
+			input:       "Write to me@example.com",
+			want:        nil,
+		},
+		{
+			description: "Inside a link",
+			input:       "https://example.com/@kota",
+			want:        nil,
+		},
+		{
+			description: "Too long",
+			input:       "@" + strings.Repeat("a", 31),
+			want:        nil,
+		},
+	}
+
+	for _, tc := range tests {
+		got := Mentions(tc.input)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%v: got: %q want: %q\n", tc.description, got, tc.want)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	type test struct {
+		description string
+		input       string
+		want        int
+		valid       bool
+		errMsg      string
+	}
+
+	tests := []test{
+		{
+			description: "Blank is never",
+			input:       "",
+			want:        0,
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Weekly",
+			input:       "2",
+			want:        2,
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Unknown frequency",
+			input:       "7",
+			valid:       false,
+			errMsg:      "Invalid digest frequency selected",
+		},
+		{
+			description: "Not a number",
+			input:       "daily",
+			valid:       false,
+			errMsg:      "Invalid digest frequency selected",
+		},
+	}
+
+	for _, tc := range tests {
+		v := New()
+		got := v.Digest(tc.input)
+		_, _, valid := v.Valid()
+
+		var errMsg string
+		if !valid {
+			for _, e := range v.FieldErrors {
+				errMsg = e
+				break
+			}
+		}
+
+		if valid != tc.valid {
+			t.Fatalf(
+				"%v: got: \"%v\" want: \"%v\" wantErr \"%v\"\n",
+				tc.description,
+				valid,
+				tc.valid,
+				tc.errMsg,
+			)
+		}
+		if errMsg != tc.errMsg {
+			t.Fatalf(
+				"%v: msg: \"%v\" wanted msg: \"%v\"\n",
+				tc.description,
+				errMsg,
+				tc.errMsg,
+			)
+		}
+		if valid && got != tc.want {
+			t.Fatalf("%v: got: %v want: %v\n", tc.description, got, tc.want)
+		}
+	}
+}
+
+func TestPasskeyName(t *testing.T) {
+	type test struct {
+		description string
+		input       string
+		valid       bool
+		errMsg      string
+	}
+
+	tests := []test{
+		{
+			description: "Basic valid name",
+			input:       "Work laptop",
+			valid:       true,
+			errMsg:      "",
+		},
+		{
+			description: "Blank",
+			input:       "  ",
+			valid:       false,
+			errMsg:      "Name cannot be blank",
+		},
+		{
+			description: "Too long",
+			input:       strings.Repeat("🔑", 51),
+			valid:       false,
+			errMsg:      "Name cannot be longer than 50 characters",
+		},
+	}
+
+	for _, tc := range tests {
+		v := New()
+		v.PasskeyName(tc.input)
+		_, _, valid := v.Valid()
+
+		var errMsg string
+		if !valid {
+			for _, e := range v.FieldErrors {
+				errMsg = e
+				break
+			}
+		}
+
+		if valid != tc.valid {
+			t.Fatalf(
+				"%v: got: \"%v\" want: \"%v\" wantErr \"%v\"\n",
+				tc.description,
+				valid,
+				tc.valid,
+				tc.errMsg,
+			)
+		}
+		if errMsg != tc.errMsg {
+			t.Fatalf(
+				"%v: msg: \"%v\" wanted msg: \"%v\"\n",
+				tc.description,
+				errMsg,
+				tc.errMsg,
+			)
+		}
+	}
+}
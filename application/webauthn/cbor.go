@@ -0,0 +1,128 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// maxDepth limits how deeply CBOR arrays and maps may be nested.
+const maxDepth = 8
+
+var errCBOR = errors.New("webauthn: malformed cbor")
+
+// decodeCBOR decodes the first CBOR data item in b and returns it along with
+// the bytes which follow it. Only the subset of CBOR used by WebAuthn is
+// supported: integers, byte and text strings, arrays, maps, and the simple
+// values false, true, and null. Integers are returned as int64, maps as
+// map[any]any, and arrays as []any.
+func decodeCBOR(b []byte) (any, []byte, error) {
+	return decodeItem(b, 0)
+}
+
+func decodeItem(b []byte, depth int) (any, []byte, error) {
+	if depth > maxDepth {
+		return nil, nil, fmt.Errorf("%w: nested too deeply", errCBOR)
+	}
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end", errCBOR)
+	}
+
+	major := b[0] >> 5
+	info := b[0] & 0x1f
+	b = b[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, b, nil
+		case 21:
+			return true, b, nil
+		case 22:
+			return nil, b, nil
+		}
+		return nil, nil, fmt.Errorf("%w: unsupported simple value", errCBOR)
+	}
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24 && len(b) >= 1:
+		arg = uint64(b[0])
+		b = b[1:]
+	case info == 25 && len(b) >= 2:
+		arg = uint64(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	case info == 26 && len(b) >= 4:
+		arg = uint64(binary.BigEndian.Uint32(b))
+		b = b[4:]
+	case info == 27 && len(b) >= 8:
+		arg = binary.BigEndian.Uint64(b)
+		b = b[8:]
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported length", errCBOR)
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return int64(arg), b, nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return -1 - int64(arg), b, nil
+	case 2, 3:
+		if arg > uint64(len(b)) {
+			return nil, nil, fmt.Errorf("%w: unexpected end", errCBOR)
+		}
+		if major == 3 {
+			return string(b[:arg]), b[arg:], nil
+		}
+		return b[:arg:arg], b[arg:], nil
+	case 4:
+		// Every item takes at least one byte.
+		if arg > uint64(len(b)) {
+			return nil, nil, fmt.Errorf("%w: unexpected end", errCBOR)
+		}
+		items := make([]any, arg)
+		for i := range items {
+			var err error
+			items[i], b, err = decodeItem(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return items, b, nil
+	case 5:
+		if arg > uint64(len(b))/2 {
+			return nil, nil, fmt.Errorf("%w: unexpected end", errCBOR)
+		}
+		m := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value any
+			var err error
+			key, b, err = decodeItem(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key", errCBOR)
+			}
+			value, b, err = decodeItem(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[key] = value
+		}
+		return m, b, nil
+	}
+	return nil, nil, fmt.Errorf("%w: unsupported type", errCBOR)
+}
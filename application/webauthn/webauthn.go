@@ -0,0 +1,342 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+
+// Package webauthn verifies the registration and authentication ceremonies
+// used by passkeys as described in the Web Authentication Level 2
+// specification. Only the parts a relying party needs for passkey login are
+// implemented: ES256, EdDSA, and RS256 public keys and the "none" attestation
+// conveyance preference.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+)
+
+// COSE algorithm identifiers for the supported public keys. Browsers are
+// asked for them in this order.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Algorithms lists the supported COSE algorithms in order of preference.
+var Algorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// ErrVerification is returned when a ceremony fails verification. It means the
+// browser or authenticator sent something wrong rather than a server fault.
+var ErrVerification = errors.New("webauthn: verification failed")
+
+// Encoding is the base64 encoding WebAuthn uses for challenges and which
+// should be used when sending binary values to and from the browser.
+var Encoding = base64.RawURLEncoding
+
+// Authenticator data flags.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// Config describes the relying party, which is this website.
+type Config struct {
+	// RPID is the domain credentials are scoped to.
+	RPID string
+
+	// Origin is the scheme, host, and port pages are served from.
+	Origin string
+}
+
+// NewConfig creates a Config for a website served at baseURL.
+func NewConfig(baseURL string) (Config, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return Config{}, err
+	}
+	if u.Scheme == "" || u.Hostname() == "" {
+		return Config{}, fmt.Errorf("webauthn: base url %q is not absolute", baseURL)
+	}
+	return Config{
+		RPID:   u.Hostname(),
+		Origin: u.Scheme + "://" + u.Host,
+	}, nil
+}
+
+// NewChallenge generates a random challenge for a ceremony. The caller must
+// store it until the browser responds, and use it only once.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// Credential is a public key credential which was registered to a user.
+type Credential struct {
+	ID []byte
+
+	// PublicKey is the credential's public key in COSE_Key format.
+	PublicKey []byte
+
+	// SignCount is the last signature counter the authenticator reported.
+	SignCount uint32
+}
+
+// Assertion is the result of a successful authentication ceremony.
+type Assertion struct {
+	// SignCount is the new signature counter which should be stored with the
+	// credential.
+	SignCount uint32
+
+	// UserVerified reports if the authenticator verified the user, with a PIN
+	// or biometric, rather than just checking they were present.
+	UserVerified bool
+}
+
+// VerifyRegistration checks the response to a navigator.credentials.create
+// call and returns the new credential.
+//
+// The attestation statement is not verified. Kudoer asks for no attestation
+// since it has no list of trusted authenticators to check one against.
+func (c Config) VerifyRegistration(
+	challenge []byte,
+	clientDataJSON []byte,
+	attestationObject []byte,
+) (Credential, error) {
+	err := c.verifyClientData(clientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	obj, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	m, ok := obj.(map[any]any)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: attestation is not a map", ErrVerification)
+	}
+	authData, ok := m["authData"].([]byte)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: missing authenticator data", ErrVerification)
+	}
+
+	flags, signCount, rest, err := c.parseAuthData(authData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if flags&flagAttested == 0 {
+		return Credential{}, fmt.Errorf("%w: missing attested credential", ErrVerification)
+	}
+
+	// Attested credential data is a 16 byte AAGUID, a 2 byte length, the
+	// credential ID, and then the public key.
+	if len(rest) < 18 {
+		return Credential{}, fmt.Errorf("%w: attested credential too short", ErrVerification)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || idLen > len(rest) {
+		return Credential{}, fmt.Errorf("%w: invalid credential id", ErrVerification)
+	}
+	id := rest[:idLen]
+	rest = rest[idLen:]
+
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	key := rest[:len(rest)-len(after)]
+	if _, _, err := parsePublicKey(key); err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:        bytes.Clone(id),
+		PublicKey: bytes.Clone(key),
+		SignCount: signCount,
+	}, nil
+}
+
+// VerifyAssertion checks the response to a navigator.credentials.get call
+// made with a credential.
+func (c Config) VerifyAssertion(
+	challenge []byte,
+	cred Credential,
+	clientDataJSON []byte,
+	authenticatorData []byte,
+	signature []byte,
+) (Assertion, error) {
+	err := c.verifyClientData(clientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	flags, signCount, _, err := c.parseAuthData(authenticatorData)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	alg, pub, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	hash := sha256.Sum256(clientDataJSON)
+	signed := append(bytes.Clone(authenticatorData), hash[:]...)
+	var valid bool
+	switch alg {
+	case AlgES256:
+		digest := sha256.Sum256(signed)
+		valid = ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), digest[:], signature)
+	case AlgEdDSA:
+		valid = ed25519.Verify(pub.(ed25519.PublicKey), signed, signature)
+	case AlgRS256:
+		digest := sha256.Sum256(signed)
+		valid = rsa.VerifyPKCS1v15(
+			pub.(*rsa.PublicKey),
+			crypto.SHA256,
+			digest[:],
+			signature,
+		) == nil
+	}
+	if !valid {
+		return Assertion{}, fmt.Errorf("%w: invalid signature", ErrVerification)
+	}
+
+	// Authenticators which don't keep a counter always send zero. Otherwise
+	// a counter which didn't go up means the credential may have been cloned.
+	if (signCount != 0 || cred.SignCount != 0) && signCount <= cred.SignCount {
+		return Assertion{}, fmt.Errorf("%w: signature counter went backwards", ErrVerification)
+	}
+
+	return Assertion{
+		SignCount:    signCount,
+		UserVerified: flags&flagUserVerified != 0,
+	}, nil
+}
+
+// verifyClientData checks the type, challenge, and origin of the client data
+// the browser signed.
+func (c Config) verifyClientData(
+	clientDataJSON []byte,
+	typ string,
+	challenge []byte,
+) error {
+	var data struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+	err := json.Unmarshal(clientDataJSON, &data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	if data.Type != typ {
+		return fmt.Errorf("%w: wrong type %q", ErrVerification, data.Type)
+	}
+	got, err := Encoding.DecodeString(data.Challenge)
+	if err != nil || len(challenge) == 0 ||
+		subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("%w: wrong challenge", ErrVerification)
+	}
+	if data.Origin != c.Origin || data.CrossOrigin {
+		return fmt.Errorf("%w: wrong origin %q", ErrVerification, data.Origin)
+	}
+	return nil
+}
+
+// parseAuthData checks the relying party and user presence in authenticator
+// data. It returns the flags, signature counter, and the data following them.
+func (c Config) parseAuthData(authData []byte) (byte, uint32, []byte, error) {
+	if len(authData) < 37 {
+		return 0, 0, nil, fmt.Errorf("%w: authenticator data too short", ErrVerification)
+	}
+	rpIDHash := sha256.Sum256([]byte(c.RPID))
+	if subtle.ConstantTimeCompare(authData[:32], rpIDHash[:]) != 1 {
+		return 0, 0, nil, fmt.Errorf("%w: wrong relying party", ErrVerification)
+	}
+	flags := authData[32]
+	if flags&flagUserPresent == 0 {
+		return 0, 0, nil, fmt.Errorf("%w: user not present", ErrVerification)
+	}
+	return flags, binary.BigEndian.Uint32(authData[33:37]), authData[37:], nil
+}
+
+// parsePublicKey decodes a COSE_Key and returns its algorithm and public key.
+func parsePublicKey(key []byte) (int, crypto.PublicKey, error) {
+	v, _, err := decodeCBOR(key)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: public key is not a map", ErrVerification)
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == AlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			break
+		}
+		// Check the point is on the curve.
+		point := append([]byte{4}, append(bytes.Clone(x), y...)...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			break
+		}
+		return AlgES256, &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case kty == 1 && alg == AlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			break
+		}
+		return AlgEdDSA, ed25519.PublicKey(bytes.Clone(x)), nil
+	case kty == 3 && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			break
+		}
+		var exp int
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		if exp < 3 {
+			break
+		}
+		return AlgRS256, &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: exp,
+		}, nil
+	}
+	return 0, nil, fmt.Errorf("%w: unsupported public key", ErrVerification)
+}
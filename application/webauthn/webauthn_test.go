@@ -0,0 +1,426 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+)
+
+// authenticator is a software authenticator holding a single credential.
+type authenticator struct {
+	id        []byte
+	rpID      string
+	ecdsa     *ecdsa.PrivateKey
+	ed25519   ed25519.PrivateKey
+	signCount uint32
+	flags     byte
+}
+
+func newAuthenticator(t *testing.T, rpID string, alg int) *authenticator {
+	a := &authenticator{
+		id:    []byte("credential-" + rpID),
+		rpID:  rpID,
+		flags: flagUserPresent | flagUserVerified,
+	}
+	var err error
+	switch alg {
+	case AlgES256:
+		a.ecdsa, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, a.ed25519, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// publicKey returns the credential's public key as a COSE_Key.
+func (a *authenticator) publicKey() []byte {
+	if a.ed25519 != nil {
+		return encodeCBOR(map[int64]any{
+			1:  int64(1),
+			3:  int64(AlgEdDSA),
+			-1: int64(6),
+			-2: []byte(a.ed25519.Public().(ed25519.PublicKey)),
+		})
+	}
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.ecdsa.X.FillBytes(x)
+	a.ecdsa.Y.FillBytes(y)
+	return encodeCBOR(map[int64]any{
+		1:  int64(2),
+		3:  int64(AlgES256),
+		-1: int64(1),
+		-2: x,
+		-3: y,
+	})
+}
+
+func (a *authenticator) authData(attested bool) []byte {
+	flags := a.flags
+	if attested {
+		flags |= flagAttested
+	}
+	hash := sha256.Sum256([]byte(a.rpID))
+	data := append(hash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, a.publicKey()...)
+	}
+	return data
+}
+
+func clientData(t *testing.T, typ string, challenge []byte, origin string) []byte {
+	b, err := json.Marshal(map[string]any{
+		"type":      typ,
+		"challenge": Encoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// create returns the client data and attestation object for registering the
+// credential.
+func (a *authenticator) create(
+	t *testing.T,
+	challenge []byte,
+	origin string,
+) ([]byte, []byte) {
+	attestation := encodeCBOR(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(true),
+	})
+	return clientData(t, "webauthn.create", challenge, origin), attestation
+}
+
+// get returns the client data, authenticator data, and signature for
+// authenticating with the credential.
+func (a *authenticator) get(
+	t *testing.T,
+	challenge []byte,
+	origin string,
+) ([]byte, []byte, []byte) {
+	a.signCount++
+	cd := clientData(t, "webauthn.get", challenge, origin)
+	ad := a.authData(false)
+	hash := sha256.Sum256(cd)
+	signed := append(append([]byte{}, ad...), hash[:]...)
+
+	if a.ed25519 != nil {
+		return cd, ad, ed25519.Sign(a.ed25519, signed)
+	}
+	digest := sha256.Sum256(signed)
+	sig, err := ecdsa.SignASN1(rand.Reader, a.ecdsa, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cd, ad, sig
+}
+
+// encodeCBOR encodes the values the tests need using canonical CBOR.
+func encodeCBOR(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b := head(5, uint64(len(v)))
+		for _, k := range keys {
+			b = append(b, encodeCBOR(k)...)
+			b = append(b, encodeCBOR(v[k])...)
+		}
+		return b
+	case map[int64]any:
+		keys := make([]int64, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		b := head(5, uint64(len(v)))
+		for _, k := range keys {
+			b = append(b, encodeCBOR(k)...)
+			b = append(b, encodeCBOR(v[k])...)
+		}
+		return b
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+func TestNewConfig(t *testing.T) {
+	type test struct {
+		baseURL string
+		want    Config
+		err     bool
+	}
+
+	tests := []test{
+		{
+			baseURL: "https://kudoer.com",
+			want:    Config{RPID: "kudoer.com", Origin: "https://kudoer.com"},
+		},
+		{
+			baseURL: "http://localhost:2024/",
+			want:    Config{RPID: "localhost", Origin: "http://localhost:2024"},
+		},
+		{
+			baseURL: "kudoer.com",
+			err:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		got, err := NewConfig(tc.baseURL)
+		if (err != nil) != tc.err {
+			t.Fatalf("%v: got error: %v want error: %v\n", tc.baseURL, err, tc.err)
+		}
+		if got != tc.want {
+			t.Fatalf("%v: got: %v want: %v\n", tc.baseURL, got, tc.want)
+		}
+	}
+}
+
+func TestCeremonies(t *testing.T) {
+	rp := Config{RPID: "kudoer.com", Origin: "https://kudoer.com"}
+
+	for _, alg := range []int{AlgES256, AlgEdDSA} {
+		a := newAuthenticator(t, rp.RPID, alg)
+
+		challenge, err := NewChallenge()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cd, att := a.create(t, challenge, rp.Origin)
+		cred, err := rp.VerifyRegistration(challenge, cd, att)
+		if err != nil {
+			t.Fatalf("alg %d: registration: %v\n", alg, err)
+		}
+		if string(cred.ID) != string(a.id) {
+			t.Fatalf("alg %d: got id: %q want: %q\n", alg, cred.ID, a.id)
+		}
+
+		for i := 0; i < 2; i++ {
+			challenge, err = NewChallenge()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cd, ad, sig := a.get(t, challenge, rp.Origin)
+			got, err := rp.VerifyAssertion(challenge, cred, cd, ad, sig)
+			if err != nil {
+				t.Fatalf("alg %d: assertion %d: %v\n", alg, i, err)
+			}
+			if got.SignCount != a.signCount || !got.UserVerified {
+				t.Fatalf("alg %d: got: %+v\n", alg, got)
+			}
+			cred.SignCount = got.SignCount
+		}
+	}
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	rp := Config{RPID: "kudoer.com", Origin: "https://kudoer.com"}
+	a := newAuthenticator(t, rp.RPID, AlgES256)
+	challenge := []byte("0123456789abcdef0123456789abcdef")
+
+	type test struct {
+		description string
+		challenge   []byte
+		origin      string
+		rpID        string
+		flags       byte
+	}
+
+	tests := []test{
+		{
+			description: "Wrong challenge",
+			challenge:   []byte("fedcba9876543210fedcba9876543210"),
+			origin:      rp.Origin,
+			rpID:        rp.RPID,
+			flags:       flagUserPresent,
+		},
+		{
+			description: "Wrong origin",
+			challenge:   challenge,
+			origin:      "https://evil.example",
+			rpID:        rp.RPID,
+			flags:       flagUserPresent,
+		},
+		{
+			description: "Wrong relying party",
+			challenge:   challenge,
+			origin:      rp.Origin,
+			rpID:        "evil.example",
+			flags:       flagUserPresent,
+		},
+		{
+			description: "User not present",
+			challenge:   challenge,
+			origin:      rp.Origin,
+			rpID:        rp.RPID,
+			flags:       0,
+		},
+	}
+
+	for _, tc := range tests {
+		a.rpID = tc.rpID
+		a.flags = tc.flags
+		cd, att := a.create(t, tc.challenge, tc.origin)
+		_, err := rp.VerifyRegistration(challenge, cd, att)
+		if !errors.Is(err, ErrVerification) {
+			t.Fatalf("%v: got error: %v want: %v\n", tc.description, err, ErrVerification)
+		}
+	}
+
+	// Assertions must not be accepted as registrations.
+	a.rpID = rp.RPID
+	a.flags = flagUserPresent
+	_, att := a.create(t, challenge, rp.Origin)
+	cd := clientData(t, "webauthn.get", challenge, rp.Origin)
+	_, err := rp.VerifyRegistration(challenge, cd, att)
+	if !errors.Is(err, ErrVerification) {
+		t.Fatalf("wrong type: got error: %v want: %v\n", err, ErrVerification)
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	rp := Config{RPID: "kudoer.com", Origin: "https://kudoer.com"}
+	a := newAuthenticator(t, rp.RPID, AlgES256)
+	other := newAuthenticator(t, rp.RPID, AlgES256)
+	challenge := []byte("0123456789abcdef0123456789abcdef")
+	cred := Credential{ID: a.id, PublicKey: a.publicKey(), SignCount: 5}
+
+	type test struct {
+		description string
+		signer      *authenticator
+		challenge   []byte
+		origin      string
+		signCount   uint32
+		flags       byte
+		err         bool
+	}
+
+	tests := []test{
+		{
+			description: "Valid",
+			signer:      a,
+			challenge:   challenge,
+			origin:      rp.Origin,
+			signCount:   9,
+			flags:       flagUserPresent,
+		},
+		{
+			description: "Wrong challenge",
+			signer:      a,
+			challenge:   []byte("fedcba9876543210fedcba9876543210"),
+			origin:      rp.Origin,
+			signCount:   9,
+			flags:       flagUserPresent,
+			err:         true,
+		},
+		{
+			description: "Wrong origin",
+			signer:      a,
+			challenge:   challenge,
+			origin:      "http://kudoer.com",
+			signCount:   9,
+			flags:       flagUserPresent,
+			err:         true,
+		},
+		{
+			description: "Wrong key",
+			signer:      other,
+			challenge:   challenge,
+			origin:      rp.Origin,
+			signCount:   9,
+			flags:       flagUserPresent,
+			err:         true,
+		},
+		{
+			description: "Counter went backwards",
+			signer:      a,
+			challenge:   challenge,
+			origin:      rp.Origin,
+			signCount:   4,
+			flags:       flagUserPresent,
+			err:         true,
+		},
+		{
+			description: "User not present",
+			signer:      a,
+			challenge:   challenge,
+			origin:      rp.Origin,
+			signCount:   9,
+			flags:       0,
+			err:         true,
+		},
+	}
+
+	for _, tc := range tests {
+		// get increments the counter before signing.
+		tc.signer.signCount = tc.signCount - 1
+		tc.signer.flags = tc.flags
+		cd, ad, sig := tc.signer.get(t, tc.challenge, tc.origin)
+		got, err := rp.VerifyAssertion(challenge, cred, cd, ad, sig)
+		if tc.err {
+			if !errors.Is(err, ErrVerification) {
+				t.Fatalf("%v: got error: %v want: %v\n", tc.description, err, ErrVerification)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: %v\n", tc.description, err)
+		}
+		if got.SignCount != tc.signCount || got.UserVerified {
+			t.Fatalf("%v: got: %+v\n", tc.description, got)
+		}
+	}
+
+	// A signature over different data must not verify.
+	a.flags = flagUserPresent
+	a.signCount = 9
+	cd, ad, sig := a.get(t, challenge, rp.Origin)
+	ad[len(ad)-1]++
+	_, err := rp.VerifyAssertion(challenge, cred, cd, ad, sig)
+	if !errors.Is(err, ErrVerification) {
+		t.Fatalf("tampered: got error: %v want: %v\n", err, ErrVerification)
+	}
+}
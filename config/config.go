@@ -2,35 +2,102 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
 
 type Config struct {
-	Addr         string
-	DSN          string
-	MSN          string
-	MailHost     string
-	MailPort     int
-	MailUsername string
-	MailPassword string
-	MailSender   string
+	Addr    string
+	BaseURL string
+	DSN     string
+	MSN     string
+
+	// MailTransport is how email is delivered: "smtp" uses the MailHost
+	// server, "sendmail" pipes messages to the MailSendmail binary, and "dir"
+	// writes each message to a .eml file in MailDir without sending it.
+	MailTransport string
+	MailHost      string
+	MailPort      int
+	MailUsername  string
+	MailPassword  string
+	MailSendmail  string
+	MailDir       string
+	MailSender    string
+
+	// Admins is a list of usernames allowed to moderate the site.
+	Admins []string
+
+	// AllowRevisits lets users give kudos to the same item more than once,
+	// with each visit recorded as its own dated kudo. Otherwise giving kudos
+	// again updates the user's existing kudo.
+	AllowRevisits bool
+
+	// TrustedProxies lists the addresses, or CIDR ranges, of reverse proxies
+	// in front of the server. The X-Forwarded-For header is only believed
+	// for requests coming from one of them.
+	TrustedProxies []string
+}
+
+// Proxies parses TrustedProxies. Single addresses are returned as a prefix
+// holding only that address.
+func (c Config) Proxies() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range c.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
 }
 
 func Load(path string) (Config, error) {
 	cfg := Config{
-		Addr:         ":2025",
-		DSN:          "kudoer.db",
-		MSN:          "media_store",
-		MailHost:     "",
-		MailPort:     25,
-		MailUsername: "",
-		MailPassword: "",
-		MailSender:   "Kudoer <no-reply@kudoer.com>",
+		Addr:          ":2025",
+		BaseURL:       "https://kudoer.com",
+		DSN:           "kudoer.db",
+		MSN:           "media_store",
+		MailTransport: "smtp",
+		MailHost:      "",
+		MailPort:      25,
+		MailUsername:  "",
+		MailPassword:  "",
+		MailSendmail:  "/usr/sbin/sendmail",
+		MailDir:       "mail",
+		MailSender:    "Kudoer <no-reply@kudoer.com>",
+		Admins:        []string{},
+		AllowRevisits: false,
+
+		TrustedProxies: []string{},
 	}
 	_, err := toml.DecodeFile(path, &cfg)
 	if err != nil {
 		return Config{}, fmt.Errorf("failed loading config: %v", err)
 	}
+	switch cfg.MailTransport {
+	case "smtp", "sendmail", "dir":
+	default:
+		return Config{}, fmt.Errorf(
+			"failed loading config: unknown MailTransport %q",
+			cfg.MailTransport,
+		)
+	}
+	if _, err := cfg.Proxies(); err != nil {
+		return Config{}, fmt.Errorf(
+			"failed loading config: invalid TrustedProxies: %v",
+			err,
+		)
+	}
 	return cfg, nil
 }
@@ -4,17 +4,77 @@ package litesession
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"log"
 	"time"
 
+	"github.com/alexedwards/scs/v2"
 	"zombiezen.com/go/sqlite"
 	"zombiezen.com/go/sqlite/sqlitex"
 )
 
+// seenInterval is how often a session's last seen time, address, and user
+// agent are updated while it's being used without being modified.
+const seenInterval = time.Minute
+
+// maxUserAgent is the longest user agent which is stored.
+const maxUserAgent = 512
+
+// ErrNoSession is returned when revoking a session which doesn't exist.
+var ErrNoSession = errors.New("litesession: no matching session")
+
 // SQLitexStore represents the session store.
 type SQLitexStore struct {
 	db          *sqlitex.Pool
 	stopCleanup chan bool
+
+	// UsernameKey is the session key holding the username a session is
+	// logged in as. Sessions are listed and revoked by this username.
+	UsernameKey string
+
+	// Codec must match the codec used by the session manager. It defaults
+	// to scs.GobCodec.
+	Codec scs.Codec
+}
+
+// Client describes the browser using a session.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type contextKey struct{}
+
+// WithClient returns a context carrying the client making a request. The
+// store records it for the request's session.
+func WithClient(ctx context.Context, client Client) context.Context {
+	if len(client.UserAgent) > maxUserAgent {
+		client.UserAgent = client.UserAgent[:maxUserAgent]
+	}
+	return context.WithValue(ctx, contextKey{}, client)
+}
+
+func clientFrom(ctx context.Context) (Client, bool) {
+	client, ok := ctx.Value(contextKey{}).(Client)
+	return client, ok
+}
+
+// Session describes an active session.
+type Session struct {
+	// ID identifies the session without revealing its token.
+	ID        string
+	Created   time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+}
+
+// ID returns the ID of the session with a token.
+func ID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
 }
 
 // New returns a new SQLitexStore instance, with a background cleanup goroutine
@@ -35,11 +95,35 @@ func NewWithCleanupInterval(db *sqlitex.Pool, cleanupInterval time.Duration) *SQ
 	return p
 }
 
+// username returns the username stored in encoded session data, or a blank
+// string.
+func (p *SQLitexStore) username(b []byte) string {
+	if p.UsernameKey == "" {
+		return ""
+	}
+	codec := p.Codec
+	if codec == nil {
+		codec = scs.GobCodec{}
+	}
+	_, values, err := codec.Decode(b)
+	if err != nil {
+		return ""
+	}
+	username, _ := values[p.UsernameKey].(string)
+	return username
+}
+
 // Find returns the data for a given session token from the SQLitexStore instance.
 // If the session token is not found or is expired, the returned exists flag will
 // be set to false.
 func (p *SQLitexStore) Find(token string) ([]byte, bool, error) {
-	conn, err := p.db.Take(context.Background())
+	return p.FindCtx(context.Background(), token)
+}
+
+// FindCtx is the same as Find, but if the context carries a client it's
+// recorded as the session's latest.
+func (p *SQLitexStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	conn, err := p.db.Take(ctx)
 	if err != nil {
 		return nil, false, err
 	}
@@ -47,13 +131,15 @@ func (p *SQLitexStore) Find(token string) ([]byte, bool, error) {
 
 	var found bool
 	var b []byte
+	var lastSeen int64
 	err = sqlitex.Execute(conn,
-		"SELECT data FROM sessions WHERE token = $1 AND julianday('now') < expiry",
+		"SELECT data, last_seen FROM sessions WHERE token = $1 AND julianday('now') < expiry",
 		&sqlitex.ExecOptions{
 			ResultFunc: func(stmt *sqlite.Stmt) error {
 				found = true
 				b = make([]byte, stmt.ColumnLen(0))
 				stmt.ColumnBytes(0, b)
+				lastSeen = stmt.ColumnInt64(1)
 				return nil
 			},
 			Args: []any{token},
@@ -65,6 +151,31 @@ func (p *SQLitexStore) Find(token string) ([]byte, bool, error) {
 	if err != nil {
 		return nil, false, err
 	}
+
+	client, ok := clientFrom(ctx)
+	now := time.Now()
+	if !ok || now.Sub(time.Unix(lastSeen, 0)) < seenInterval {
+		return b, true, nil
+	}
+
+	// The username is also set in case the session was created before it
+	// was recorded.
+	err = sqlitex.Execute(conn,
+		`UPDATE sessions SET last_seen = :now, ip = :ip,
+			user_agent = :user_agent, username = :username
+		WHERE token = :token`,
+		&sqlitex.ExecOptions{
+			Named: map[string]any{
+				":now":        now.Unix(),
+				":ip":         client.IP,
+				":user_agent": client.UserAgent,
+				":username":   p.username(b),
+				":token":      token,
+			},
+		})
+	if err != nil {
+		return nil, false, err
+	}
 	return b, true, nil
 }
 
@@ -72,16 +183,42 @@ func (p *SQLitexStore) Find(token string) ([]byte, bool, error) {
 // given expiry time. If the session token already exists, then the data and expiry
 // time are updated.
 func (p *SQLitexStore) Commit(token string, b []byte, expiry time.Time) error {
-	conn, err := p.db.Take(context.Background())
+	return p.CommitCtx(context.Background(), token, b, expiry)
+}
+
+// CommitCtx is the same as Commit, but if the context carries a client it's
+// recorded as the session's latest.
+func (p *SQLitexStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	conn, err := p.db.Take(ctx)
 	if err != nil {
 		return err
 	}
 	defer p.db.Put(conn)
 
+	client, ok := clientFrom(ctx)
 	err = sqlitex.Execute(conn,
-		"REPLACE INTO sessions (token, data, expiry) VALUES ($1, $2, julianday($3))",
+		`INSERT INTO sessions (token, data, expiry, username, created_at,
+			last_seen, ip, user_agent)
+		VALUES (:token, :data, julianday(:expiry), :username, :now, :now, :ip,
+			:user_agent)
+		ON CONFLICT (token) DO UPDATE SET
+			data = excluded.data,
+			expiry = excluded.expiry,
+			username = excluded.username,
+			last_seen = iif(:client, excluded.last_seen, last_seen),
+			ip = iif(:client, excluded.ip, ip),
+			user_agent = iif(:client, excluded.user_agent, user_agent)`,
 		&sqlitex.ExecOptions{
-			Args: []any{token, b, expiry.UTC().Format("2006-01-02T15:04:05.999")},
+			Named: map[string]any{
+				":token":      token,
+				":data":       b,
+				":expiry":     expiry.UTC().Format("2006-01-02T15:04:05.999"),
+				":username":   p.username(b),
+				":now":        time.Now().Unix(),
+				":ip":         client.IP,
+				":user_agent": client.UserAgent,
+				":client":     ok,
+			},
 		})
 	return err
 }
@@ -89,7 +226,12 @@ func (p *SQLitexStore) Commit(token string, b []byte, expiry time.Time) error {
 // Delete removes a session token and corresponding data from the SQLitexStore
 // instance.
 func (p *SQLitexStore) Delete(token string) error {
-	conn, err := p.db.Take(context.Background())
+	return p.DeleteCtx(context.Background(), token)
+}
+
+// DeleteCtx is the same as Delete, but takes a context.
+func (p *SQLitexStore) DeleteCtx(ctx context.Context, token string) error {
+	conn, err := p.db.Take(ctx)
 	if err != nil {
 		return err
 	}
@@ -105,7 +247,12 @@ func (p *SQLitexStore) Delete(token string) error {
 // All returns a map containing the token and data for all active (i.e.
 // not expired) sessions in the SQLitexStore instance.
 func (p *SQLitexStore) All() (map[string][]byte, error) {
-	conn, err := p.db.Take(context.Background())
+	return p.AllCtx(context.Background())
+}
+
+// AllCtx is the same as All, but takes a context.
+func (p *SQLitexStore) AllCtx(ctx context.Context) (map[string][]byte, error) {
+	conn, err := p.db.Take(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -130,6 +277,70 @@ func (p *SQLitexStore) All() (map[string][]byte, error) {
 	return sessions, nil
 }
 
+// Sessions returns the active sessions logged in as a user, most recently
+// seen first.
+func (p *SQLitexStore) Sessions(ctx context.Context, username string) ([]Session, error) {
+	conn, err := p.db.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer p.db.Put(conn)
+
+	var sessions []Session
+	err = sqlitex.Execute(conn,
+		`SELECT token, created_at, last_seen, ip, user_agent FROM sessions
+		WHERE username = $1 AND julianday('now') < expiry
+		ORDER BY last_seen DESC`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				sessions = append(sessions, Session{
+					ID:        ID(stmt.ColumnText(0)),
+					Created:   time.Unix(stmt.ColumnInt64(1), 0),
+					LastSeen:  time.Unix(stmt.ColumnInt64(2), 0),
+					IP:        stmt.ColumnText(3),
+					UserAgent: stmt.ColumnText(4),
+				})
+				return nil
+			},
+			Args: []any{username},
+		})
+	return sessions, err
+}
+
+// Revoke deletes one of a user's sessions by its ID, logging it out. If the
+// user has no session with that ID ErrNoSession is returned.
+func (p *SQLitexStore) Revoke(ctx context.Context, username, id string) error {
+	conn, err := p.db.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.db.Put(conn)
+
+	var token string
+	err = sqlitex.Execute(conn,
+		"SELECT token FROM sessions WHERE username = $1",
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				if t := stmt.ColumnText(0); ID(t) == id {
+					token = t
+				}
+				return nil
+			},
+			Args: []any{username},
+		})
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return ErrNoSession
+	}
+
+	return sqlitex.Execute(conn, "DELETE FROM sessions WHERE token = $1",
+		&sqlitex.ExecOptions{
+			Args: []any{token},
+		})
+}
+
 func (p *SQLitexStore) startCleanup(interval time.Duration) {
 	p.stopCleanup = make(chan bool)
 	ticker := time.NewTicker(interval)
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS item_revisions (
+	id TEXT NOT NULL PRIMARY KEY,
+	item_id TEXT NOT NULL,
+	editor_username TEXT NOT NULL,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL,
+	source TEXT NOT NULL,
+	FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE,
+	FOREIGN KEY (editor_username) REFERENCES users (username)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS item_revisions_item_idx ON item_revisions (item_id);
+
+INSERT INTO item_revisions (id, item_id, editor_username, name, description, source)
+	SELECT
+		id,
+		id,
+		creator_username,
+		name,
+		description,
+		source
+	FROM
+		items;
+
+CREATE TRIGGER IF NOT EXISTS after_items_update AFTER UPDATE OF name ON items
+	BEGIN UPDATE items_search SET name = new.name WHERE id = old.id;
+END;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS item_redirects (
+	id TEXT NOT NULL PRIMARY KEY,
+	target_id TEXT NOT NULL,
+	merger_username TEXT NOT NULL,
+	merged INTEGER NOT NULL,
+	FOREIGN KEY (target_id) REFERENCES items (id),
+	FOREIGN KEY (merger_username) REFERENCES users (username)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS item_redirects_target_idx ON item_redirects (target_id);
+
+CREATE TRIGGER IF NOT EXISTS after_items_delete AFTER DELETE ON items
+	BEGIN DELETE FROM items_search WHERE id = old.id;
+END;
@@ -0,0 +1,68 @@
+ALTER TABLE items ADD kind TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS items_kind_idx ON items (kind);
+
+CREATE TABLE IF NOT EXISTS item_attributes (
+	item_id TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	CONSTRAINT item_attribute_key PRIMARY KEY (item_id, key),
+	FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE
+) WITHOUT ROWID;
+
+ALTER TABLE item_revisions ADD kind TEXT NOT NULL DEFAULT '';
+ALTER TABLE item_revisions ADD attributes TEXT NOT NULL DEFAULT '{}';
+
+DROP TRIGGER IF EXISTS after_items_insert;
+DROP TRIGGER IF EXISTS after_items_update;
+DROP TRIGGER IF EXISTS after_items_delete;
+DROP TABLE IF EXISTS items_search;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS items_search USING fts5(
+			id,
+			name,
+			attributes,
+			tokenize = porter
+		);
+
+INSERT INTO items_search (id, name, attributes)
+		SELECT
+			id,
+			name,
+			''
+		FROM
+			items;
+
+CREATE TRIGGER IF NOT EXISTS after_items_insert AFTER INSERT ON items
+	BEGIN INSERT INTO items_search (id, name, attributes)
+	VALUES (new.id, new.name, '');
+END;
+
+CREATE TRIGGER IF NOT EXISTS after_items_update AFTER UPDATE OF name ON items
+	BEGIN UPDATE items_search SET name = new.name WHERE id = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS after_items_delete AFTER DELETE ON items
+	BEGIN DELETE FROM items_search WHERE id = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS after_item_attributes_insert AFTER INSERT ON item_attributes
+	BEGIN UPDATE items_search SET attributes = (
+		SELECT coalesce(group_concat(value, ' '), '')
+		FROM item_attributes WHERE item_id = new.item_id
+	) WHERE id = new.item_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS after_item_attributes_update AFTER UPDATE ON item_attributes
+	BEGIN UPDATE items_search SET attributes = (
+		SELECT coalesce(group_concat(value, ' '), '')
+		FROM item_attributes WHERE item_id = new.item_id
+	) WHERE id = new.item_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS after_item_attributes_delete AFTER DELETE ON item_attributes
+	BEGIN UPDATE items_search SET attributes = (
+		SELECT coalesce(group_concat(value, ' '), '')
+		FROM item_attributes WHERE item_id = old.item_id
+	) WHERE id = old.item_id;
+END;
@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS items_source_idx ON items (source) WHERE source != '';
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS item_images (
+	filename TEXT NOT NULL,
+	item_id TEXT NOT NULL,
+	kind INTEGER NOT NULL,
+	CONSTRAINT item_kind_key PRIMARY KEY (item_id, kind),
+	FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS item_images_item_idx ON item_images (item_id);
+CREATE INDEX IF NOT EXISTS item_images_kindx ON item_images (kind);
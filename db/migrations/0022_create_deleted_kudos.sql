@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS deleted_kudos (
+	id TEXT NOT NULL PRIMARY KEY,
+	item_id TEXT NOT NULL,
+	creator_username TEXT NOT NULL,
+	frame INTEGER NOT NULL,
+	emoji INTEGER NOT NULL,
+	body TEXT NOT NULL,
+	deleted INTEGER NOT NULL,
+	FOREIGN KEY (creator_username) REFERENCES users (username)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS deleted_kudos_deletedx ON deleted_kudos (deleted);
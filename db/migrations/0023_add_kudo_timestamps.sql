@@ -0,0 +1,22 @@
+-- Kudos created before this migration have a zero created_at and updated_at.
+-- Their creation time is read from their ID instead.
+ALTER TABLE kudos ADD created_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE kudos ADD updated_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE deleted_kudos ADD created_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE deleted_kudos ADD updated_at INTEGER NOT NULL DEFAULT 0;
+
+-- Revisions are kept when a kudo is deleted so they come back if it's restored.
+-- They're removed once the deleted kudo is purged.
+CREATE TABLE IF NOT EXISTS kudo_revisions (
+	id TEXT NOT NULL PRIMARY KEY,
+	kudo_id TEXT NOT NULL,
+	frame INTEGER NOT NULL,
+	emoji INTEGER NOT NULL,
+	body TEXT NOT NULL
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS kudo_revisions_kudo_idx ON kudo_revisions (kudo_id);
+
+-- Existing kudos get their current version as their first revision.
+INSERT INTO kudo_revisions (id, kudo_id, frame, emoji, body)
+SELECT id, id, frame, emoji, body FROM kudos;
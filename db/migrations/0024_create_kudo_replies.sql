@@ -0,0 +1,14 @@
+-- A reply with a blank parent_id replies to the kudo itself.
+-- Deleted replies keep their row, without a body, so the replies to them stay
+-- in place.
+CREATE TABLE IF NOT EXISTS kudo_replies (
+	id TEXT NOT NULL PRIMARY KEY,
+	kudo_id TEXT NOT NULL,
+	parent_id TEXT NOT NULL DEFAULT '',
+	creator_username TEXT NOT NULL,
+	body TEXT NOT NULL,
+	deleted INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY (creator_username) REFERENCES users (username)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS kudo_replies_kudo_idx ON kudo_replies (kudo_id);
@@ -0,0 +1,3 @@
+-- Finds a user's kudos for an item, newest first, when revisits are allowed.
+CREATE INDEX IF NOT EXISTS kudos_item_creator_idx
+ON kudos (item_id, creator_username, id);
@@ -0,0 +1,3 @@
+-- Who may see a kudo: 0 is public, 1 is followers only, 2 is private.
+ALTER TABLE kudos ADD visibility INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE deleted_kudos ADD visibility INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- An optional content warning which hides a kudo's body until it is opened.
+ALTER TABLE kudos ADD warning TEXT NOT NULL DEFAULT '';
+ALTER TABLE deleted_kudos ADD warning TEXT NOT NULL DEFAULT '';
+ALTER TABLE kudo_revisions ADD warning TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,23 @@
+-- Users mentioned with an @username in a kudo's body.
+-- Mentions of unknown users are not stored.
+CREATE TABLE IF NOT EXISTS kudo_mentions (
+	kudo_id TEXT NOT NULL,
+	username TEXT NOT NULL,
+	PRIMARY KEY (kudo_id, username),
+	FOREIGN KEY (username) REFERENCES users (username)
+) WITHOUT ROWID;
+
+-- Notifications are shown to username about something actor_username did.
+-- The kind decides which of the other columns are used.
+CREATE TABLE IF NOT EXISTS notifications (
+	id TEXT NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL,
+	kind INTEGER NOT NULL,
+	actor_username TEXT NOT NULL,
+	kudo_id TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (username) REFERENCES users (username),
+	FOREIGN KEY (actor_username) REFERENCES users (username)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS notifications_username_idx
+ON notifications (username, id);
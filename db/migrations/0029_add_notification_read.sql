@@ -0,0 +1,4 @@
+ALTER TABLE notifications ADD read INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS notifications_unread_idx
+ON notifications (username, read);
@@ -0,0 +1,11 @@
+-- How often a user gets an email digest: 0 is never, 1 daily, 2 weekly.
+-- digest_sent is the unix time the last digest covered activity up to.
+ALTER TABLE users ADD digest INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD digest_sent INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS unsubscribe_tokens (
+	hash BLOB NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL,
+	expiry INTEGER NOT NULL,
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+);
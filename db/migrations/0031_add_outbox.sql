@@ -0,0 +1,16 @@
+-- Email waiting to be sent. Messages are stored fully rendered so they can be
+-- sent after a restart. next_attempt is the unix time of the next try, and
+-- messages which failed too many times are marked dead and left for an admin.
+CREATE TABLE IF NOT EXISTS outbox (
+	id TEXT NOT NULL PRIMARY KEY,
+	recipient TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	text_body TEXT NOT NULL,
+	html_body TEXT NOT NULL DEFAULT '',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt INTEGER NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	dead INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS outbox_next_attempt ON outbox (dead, next_attempt);
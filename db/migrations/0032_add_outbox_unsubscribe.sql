@@ -0,0 +1,3 @@
+-- The link which unsubscribes the recipient from messages like this one, sent
+-- in the List-Unsubscribe header. Blank if the message isn't a subscription.
+ALTER TABLE outbox ADD unsubscribe TEXT NOT NULL DEFAULT '';
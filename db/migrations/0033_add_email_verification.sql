@@ -0,0 +1,16 @@
+-- email is the address mail is sent to and email_verified is set once the user
+-- followed a link sent to it. A new address waits in pending_email until it is
+-- verified, so the old one keeps working. Existing addresses are trusted since
+-- they were already used for password resets, otherwise their owners couldn't
+-- reset a forgotten password at all.
+ALTER TABLE users ADD email_verified INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD pending_email TEXT NOT NULL DEFAULT '';
+UPDATE users SET email_verified = 1 WHERE email != '';
+
+CREATE TABLE IF NOT EXISTS verification_tokens (
+	hash BLOB NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL,
+	email TEXT NOT NULL,
+	expiry INTEGER NOT NULL,
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+);
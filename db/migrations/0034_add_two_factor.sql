@@ -0,0 +1,11 @@
+-- totp_secret is the base32 TOTP secret for users who turned on two-factor
+-- authentication, or blank. totp_step is the last time step a code was used
+-- for, so a code can't be used twice.
+ALTER TABLE users ADD totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD totp_step INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	hash BLOB NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL,
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+);
@@ -0,0 +1,16 @@
+-- Passkeys are WebAuthn credentials users log in with instead of a password.
+-- public_key is a COSE_Key and sign_count the last signature counter the
+-- authenticator reported, used to notice cloned authenticators.
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+	id BLOB NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL,
+	name TEXT NOT NULL,
+	public_key BLOB NOT NULL,
+	sign_count INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL,
+	last_used INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_username_idx
+ON webauthn_credentials (username);
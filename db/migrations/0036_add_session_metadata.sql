@@ -0,0 +1,14 @@
+-- Sessions record who they're logged in as and the browser using them so users
+-- can see and revoke their sessions. When existing sessions were created isn't
+-- known, so they're counted from now. Their username and browser are filled in
+-- the next time they're used.
+ALTER TABLE sessions ADD username TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD created_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sessions ADD last_seen INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sessions ADD ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD user_agent TEXT NOT NULL DEFAULT '';
+UPDATE sessions SET
+	created_at = CAST(strftime('%s', 'now') AS INTEGER),
+	last_seen = CAST(strftime('%s', 'now') AS INTEGER);
+
+CREATE INDEX IF NOT EXISTS sessions_username_idx ON sessions (username);
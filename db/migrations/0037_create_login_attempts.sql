@@ -0,0 +1,13 @@
+-- Failed logins are counted per username, whether or not the user exists, so
+-- the responses don't reveal which usernames are taken. next_attempt is the
+-- earliest another login may be tried and locked_until is set when the account
+-- is locked out. reserved_until is set while a login is being checked so
+-- others can't be tried at the same time, and lapses if it's never finished.
+CREATE TABLE IF NOT EXISTS login_attempts (
+	username TEXT NOT NULL PRIMARY KEY,
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure INTEGER NOT NULL DEFAULT 0,
+	next_attempt INTEGER NOT NULL DEFAULT 0,
+	locked_until INTEGER NOT NULL DEFAULT 0,
+	reserved_until INTEGER NOT NULL DEFAULT 0
+) WITHOUT ROWID;
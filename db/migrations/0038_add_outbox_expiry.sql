@@ -0,0 +1,9 @@
+-- The outbox holds messages fully rendered, so some of them contain secrets
+-- such as password reset tokens. expires is the unix time those secrets stop
+-- working, after which the message is deleted whether or not it was sent. It's
+-- 0 for messages without a secret.
+ALTER TABLE outbox ADD expires INTEGER NOT NULL DEFAULT 0;
+
+-- Messages queued before this have no expiry. Reset tokens only work for 45
+-- minutes, so queued resets are dropped rather than kept forever.
+DELETE FROM outbox WHERE subject = 'Kudoer - Password Reset';
@@ -0,0 +1,204 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/oklog/ulid"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// Delete removes a kudo given by a user and returns the ID of the item it was
+// given to. The kudo is kept in the deleted_kudos table so it can be restored
+// until it is purged.
+func (m *KudoModel) Delete(
+	ctx context.Context,
+	id ulid.ULID,
+	creator_username string,
+) (itemID ulid.ULID, err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return itemID, err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return itemID, err
+	}
+	defer endFn(&err)
+
+	var found bool
+	err = sqlitex.Execute(
+		conn,
+		`SELECT item_id FROM kudos WHERE id = ? AND creator_username = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				found = true
+				itemID, err = ulid.Parse(stmt.ColumnText(0))
+				return err
+			},
+			Args: []any{id, creator_username},
+		},
+	)
+	if err != nil {
+		return itemID, err
+	}
+	if !found {
+		return itemID, ErrNoRecord
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`INSERT OR REPLACE INTO deleted_kudos
+		(id, item_id, creator_username, frame, emoji, body, warning, visibility,
+		created_at, updated_at, deleted)
+		SELECT id, item_id, creator_username, frame, emoji, body, warning, visibility,
+		created_at, updated_at, ?
+		FROM kudos WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{time.Now().Unix(), id}},
+	)
+	if err != nil {
+		return itemID, err
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`DELETE FROM kudos WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{id}},
+	)
+	return itemID, err
+}
+
+// Restore brings back a kudo deleted by a user after the given time and
+// returns the ID of the item it was given to.
+//
+// Unless revisits are allowed, ErrKudoExists is returned if the user has since
+// given new kudos to the item.
+func (m *KudoModel) Restore(
+	ctx context.Context,
+	id ulid.ULID,
+	creator_username string,
+	since time.Time,
+	revisits bool,
+) (itemID ulid.ULID, err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return itemID, err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return itemID, err
+	}
+	defer endFn(&err)
+
+	var found bool
+	err = sqlitex.Execute(
+		conn,
+		`SELECT item_id FROM deleted_kudos
+		WHERE id = ? AND creator_username = ? AND deleted >= ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				found = true
+				itemID, err = ulid.Parse(stmt.ColumnText(0))
+				return err
+			},
+			Args: []any{id, creator_username, since.Unix()},
+		},
+	)
+	if err != nil {
+		return itemID, err
+	}
+	if !found {
+		return itemID, ErrNoRecord
+	}
+
+	var exists bool
+	err = sqlitex.Execute(
+		conn,
+		`SELECT id FROM kudos WHERE item_id = ? AND creator_username = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				exists = true
+				return nil
+			},
+			Args: []any{itemID, creator_username},
+		},
+	)
+	if err != nil {
+		return itemID, err
+	}
+	if exists && !revisits {
+		return itemID, ErrKudoExists
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`INSERT INTO kudos
+		(id, item_id, creator_username, frame, emoji, body, warning, visibility,
+		created_at, updated_at)
+		SELECT id, item_id, creator_username, frame, emoji, body, warning, visibility,
+		created_at, updated_at
+		FROM deleted_kudos WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{id}},
+	)
+	if err != nil {
+		return itemID, err
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`DELETE FROM deleted_kudos WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{id}},
+	)
+	return itemID, err
+}
+
+// kudoDependents are the tables holding rows which belong to a kudo. They are
+// kept while a kudo is deleted so it can be restored, and removed with it for
+// good.
+var kudoDependents = []string{
+	"kudo_revisions",
+	"kudo_replies",
+	"kudo_mentions",
+	"notifications",
+}
+
+// Purge permanently removes kudos which were deleted before the given time.
+func (m *KudoModel) Purge(ctx context.Context, before time.Time) (err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
+	for _, table := range kudoDependents {
+		err = sqlitex.Execute(
+			conn,
+			`DELETE FROM `+table+` WHERE kudo_id IN (
+				SELECT id FROM deleted_kudos WHERE deleted < ?
+			)`,
+			&sqlitex.ExecOptions{Args: []any{before.Unix()}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sqlitex.Execute(
+		conn,
+		`DELETE FROM deleted_kudos WHERE deleted < ?`,
+		&sqlitex.ExecOptions{Args: []any{before.Unix()}},
+	)
+}
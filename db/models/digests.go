@@ -0,0 +1,350 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"time"
+
+	"github.com/oklog/ulid"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// UnsubscribeTTL is how long the unsubscribe link in a digest keeps working.
+const UnsubscribeTTL = 60 * 24 * time.Hour
+
+// digestKudos limits how many kudos are listed in a single digest.
+const digestKudos = 50
+
+// DigestFrequency is how often a user is sent a digest.
+type DigestFrequency int
+
+const (
+	DigestNever DigestFrequency = iota
+	DigestDaily
+	DigestWeekly
+)
+
+// Period returns the time between two digests.
+func (f DigestFrequency) Period() time.Duration {
+	switch f {
+	case DigestDaily:
+		return 24 * time.Hour
+	case DigestWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// Digest summarizes what happened for a user between two times.
+type Digest struct {
+	Username    string
+	DisplayName string
+	Email       string
+	Frequency   DigestFrequency
+	Since       time.Time
+	Until       time.Time
+
+	// Newest kudos from the people the user follows.
+	Kudos []Kudo
+
+	// Users who started following the user.
+	Followers []User
+}
+
+// Empty reports if nothing happened during the digest's period.
+func (d Digest) Empty() bool {
+	return len(d.Kudos) == 0 && len(d.Followers) == 0
+}
+
+// DigestModel handles email digest storage.
+type DigestModel struct {
+	DB *sqlitex.Pool
+}
+
+// Frequency returns how often a user wants a digest.
+func (m *DigestModel) Frequency(
+	ctx context.Context,
+	username string,
+) (DigestFrequency, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return DigestNever, err
+	}
+	defer m.DB.Put(conn)
+
+	var f DigestFrequency
+	err = sqlitex.Execute(conn, `SELECT digest FROM users WHERE username = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				f = DigestFrequency(stmt.ColumnInt(0))
+				return nil
+			},
+			Args: []any{username},
+		})
+	return f, err
+}
+
+// Subscribe changes how often a user gets a digest. The first digest after
+// subscribing covers what happens from now on.
+func (m *DigestModel) Subscribe(
+	ctx context.Context,
+	username string,
+	frequency DigestFrequency,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	return sqlitex.Execute(
+		conn,
+		`UPDATE users SET
+			digest_sent = CASE WHEN digest = 0 THEN ? ELSE digest_sent END,
+			digest = ?
+		WHERE username = ?`,
+		&sqlitex.ExecOptions{
+			Args: []any{time.Now().Unix(), frequency, username},
+		},
+	)
+}
+
+// Due returns the users whose next digest should be sent by now. Digests are
+// only sent to verified addresses.
+func (m *DigestModel) Due(ctx context.Context, now time.Time) ([]string, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.DB.Put(conn)
+
+	var usernames []string
+	err = sqlitex.Execute(
+		conn,
+		`SELECT username FROM users
+		WHERE email != '' AND email_verified = 1 AND (
+			(digest = ? AND digest_sent <= ?) OR
+			(digest = ? AND digest_sent <= ?)
+		)`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				usernames = append(usernames, stmt.ColumnText(0))
+				return nil
+			},
+			Args: []any{
+				DigestDaily,
+				now.Add(-DigestDaily.Period()).Unix(),
+				DigestWeekly,
+				now.Add(-DigestWeekly.Period()).Unix(),
+			},
+		},
+	)
+	return usernames, err
+}
+
+// Claim collects a user's digest if it is due, and records it as sent so it
+// is never collected twice, even by another process. If the digest is not due
+// ErrNoRecord is returned.
+func (m *DigestModel) Claim(
+	ctx context.Context,
+	username string,
+	now time.Time,
+) (d Digest, err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return d, err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return d, err
+	}
+	defer endFn(&err)
+
+	var found bool
+	var sent int64
+	err = sqlitex.Execute(
+		conn,
+		`SELECT displayname, email, digest, digest_sent FROM users
+		WHERE username = ? AND email_verified = 1`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				found = true
+				d.DisplayName = stmt.ColumnText(0)
+				d.Email = stmt.ColumnText(1)
+				d.Frequency = DigestFrequency(stmt.ColumnInt(2))
+				sent = stmt.ColumnInt64(3)
+				return nil
+			},
+			Args: []any{username},
+		},
+	)
+	if err != nil {
+		return d, err
+	}
+	period := d.Frequency.Period()
+	if !found || d.Email == "" || period == 0 ||
+		time.Unix(sent, 0).Add(period).After(now) {
+		return d, ErrNoRecord
+	}
+
+	d.Username = username
+	d.Until = now
+	d.Since = time.Unix(sent, 0)
+	// Don't look further back than a single period, such as when the server
+	// was down for a long time.
+	if d.Since.Before(now.Add(-period)) {
+		d.Since = now.Add(-period)
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE users SET digest_sent = ? WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{now.Unix(), username}},
+	)
+	if err != nil {
+		return d, err
+	}
+
+	d.Kudos, err = listKudos(conn,
+		`SELECT `+kudoColumns+`
+FROM users_following
+JOIN kudos
+	ON users_following.following_username = kudos.creator_username`+kudoJoins+`
+WHERE users_following.username = :viewer AND `+visible("kudos")+`
+AND kudos.created_at > :since AND kudos.created_at <= :until
+ORDER BY kudos.id DESC LIMIT :limit`,
+		map[string]any{
+			":viewer": username,
+			":since":  d.Since.Unix(),
+			":until":  d.Until.Unix(),
+			":limit":  digestKudos,
+		})
+	if err != nil {
+		return d, err
+	}
+
+	// Follows are only timestamped by the notification they sent.
+	var since, until ulid.ULID
+	if err := since.SetTime(ulid.Timestamp(d.Since)); err != nil {
+		return d, err
+	}
+	if err := until.SetTime(ulid.Timestamp(d.Until)); err != nil {
+		return d, err
+	}
+	err = sqlitex.Execute(
+		conn,
+		`SELECT users.username, users.displayname FROM notifications
+		JOIN users
+			ON notifications.actor_username = users.username
+		WHERE notifications.username = ? AND notifications.kind = ?
+		AND notifications.id >= ? AND notifications.id < ?
+		ORDER BY notifications.id`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				d.Followers = append(d.Followers, User{
+					Username:    stmt.ColumnText(0),
+					DisplayName: stmt.ColumnText(1),
+				})
+				return nil
+			},
+			Args: []any{username, NotificationFollow, since, until},
+		},
+	)
+	return d, err
+}
+
+// NewUnsubscribeToken creates a token which turns off a user's digests, stores
+// the hash in the database, and returns the plaintext version to be put in the
+// digest. Expired tokens are cleaned up along the way.
+func (m *DigestModel) NewUnsubscribeToken(
+	ctx context.Context,
+	username string,
+) (string, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer m.DB.Put(conn)
+
+	err = sqlitex.Execute(
+		conn,
+		`DELETE FROM unsubscribe_tokens WHERE expiry <= ?`,
+		&sqlitex.ExecOptions{Args: []any{time.Now().Unix()}},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := generateToken(username, UnsubscribeTTL)
+	if err != nil {
+		return "", err
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`INSERT INTO unsubscribe_tokens (hash, username, expiry) VALUES (?, ?, ?)`,
+		&sqlitex.ExecOptions{
+			Args: []any{token.Hash, username, token.Expiry.Unix()},
+		},
+	)
+	return token.Plaintext, err
+}
+
+// Unsubscribe turns off digests for the user an unsubscribe token was made
+// for and returns their username.
+func (m *DigestModel) Unsubscribe(
+	ctx context.Context,
+	token string,
+) (username string, err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return "", err
+	}
+	defer endFn(&err)
+
+	sum := sha256.Sum256([]byte(token))
+	err = sqlitex.Execute(
+		conn,
+		`SELECT username FROM unsubscribe_tokens WHERE hash = ? AND expiry > ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				username = stmt.ColumnText(0)
+				return nil
+			},
+			Args: []any{sum[:], time.Now().Unix()},
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	if username == "" {
+		return "", ErrUnsubscribeTokenInvalid
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE users SET digest = ? WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{DigestNever, username}},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`DELETE FROM unsubscribe_tokens WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{username}},
+	)
+	return username, err
+}
@@ -0,0 +1,131 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"time"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// VerificationTTL is how long an email verification token keeps working.
+const VerificationTTL = 48 * time.Hour
+
+// VerificationModel handles email verification token storage.
+type VerificationModel struct {
+	DB *sqlitex.Pool
+}
+
+// New creates a token which verifies a user owns an email address, stores the
+// hash in the database, and returns the plaintext version to be sent to the
+// address.
+//
+// New will delete ALL existing tokens for this username before creating a new
+// token.
+func (m *VerificationModel) New(
+	ctx context.Context,
+	username string,
+	email string,
+) (string, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer m.DB.Put(conn)
+
+	err = sqlitex.Execute(
+		conn,
+		`DELETE FROM verification_tokens WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{username}},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := generateToken(username, VerificationTTL)
+	if err != nil {
+		return "", err
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`INSERT INTO verification_tokens (hash, username, email, expiry)
+		VALUES (?, ?, ?, ?)`,
+		&sqlitex.ExecOptions{
+			Args: []any{token.Hash, username, email, token.Expiry.Unix()},
+		},
+	)
+	return token.Plaintext, err
+}
+
+// Verify marks the address a token was sent to as verified and returns the
+// username it belongs to. A pending address replaces the user's current one.
+// The token is invalid if it expired or the user changed their email since it
+// was sent.
+func (m *VerificationModel) Verify(
+	ctx context.Context,
+	token string,
+) (username string, err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return "", err
+	}
+	defer endFn(&err)
+
+	sum := sha256.Sum256([]byte(token))
+	var email string
+	err = sqlitex.Execute(
+		conn,
+		`SELECT username, email FROM verification_tokens
+		WHERE hash = ? AND expiry > ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				username = stmt.ColumnText(0)
+				email = stmt.ColumnText(1)
+				return nil
+			},
+			Args: []any{sum[:], time.Now().Unix()},
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	if username == "" {
+		return "", ErrVerificationTokenInvalid
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE users SET email = :email, email_verified = 1, pending_email = ''
+		WHERE username = :username
+		AND (email = :email OR pending_email = :email)`,
+		&sqlitex.ExecOptions{
+			Named: map[string]any{
+				":email":    email,
+				":username": username,
+			},
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	if conn.Changes() == 0 {
+		return "", ErrVerificationTokenInvalid
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`DELETE FROM verification_tokens WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{username}},
+	)
+	return username, err
+}
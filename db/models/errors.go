@@ -8,4 +8,11 @@ var ErrNoRecord = errors.New("model: no matching record found")
 var ErrUsernameExists = errors.New("model: that username already exists")
 var ErrAlreadyFollowing = errors.New("model: already following this user")
 var ErrInvalidCredentials = errors.New("model: submitted credentials are invalid")
+var ErrSourceExists = errors.New("model: another item already has that source")
 var ErrPWResetTokenInvalid = errors.New("model: password reset token missing or invalid")
+var ErrUnsubscribeTokenInvalid = errors.New("model: unsubscribe token missing or invalid")
+var ErrVerificationTokenInvalid = errors.New("model: email verification token missing or invalid")
+var ErrKudoExists = errors.New("model: a kudo for that item already exists")
+var ErrPasskeyExists = errors.New("model: that passkey is already registered")
+var ErrReplyTooDeep = errors.New("model: replies cannot be nested any deeper")
+var ErrLoginInProgress = errors.New("model: another login is being checked")
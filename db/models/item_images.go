@@ -0,0 +1,93 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+
+	"github.com/oklog/ulid"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// ItemImage is a mapping of all of an item's cover image formats to their
+// filenames.
+type ItemImage map[ItemImageKind]string
+
+type ItemImageKind int
+
+const (
+	ItemCoverJPEG600 ItemImageKind = iota
+	ItemCoverJPEG150
+)
+
+// ItemImageModel handles item image metadata storage.
+type ItemImageModel struct {
+	DB *sqlitex.Pool
+}
+
+// Set an item's cover image. Both sizes are replaced together.
+func (m *ItemImageModel) Set(
+	ctx context.Context,
+	itemID ulid.ULID,
+	cover600 string,
+	cover150 string,
+) (err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
+	err = sqlitex.Execute(
+		conn,
+		`INSERT OR REPLACE INTO item_images
+		(filename, item_id, kind) VALUES (?, ?, ?)`,
+		&sqlitex.ExecOptions{Args: []any{cover600, itemID, ItemCoverJPEG600}},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`INSERT OR REPLACE INTO item_images
+		(filename, item_id, kind) VALUES (?, ?, ?)`,
+		&sqlitex.ExecOptions{Args: []any{cover150, itemID, ItemCoverJPEG150}},
+	)
+	return err
+}
+
+// Get an item's cover images.
+func (m *ItemImageModel) Get(
+	ctx context.Context,
+	itemID ulid.ULID,
+) (ItemImage, error) {
+	ii := make(ItemImage)
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return ii, err
+	}
+	defer m.DB.Put(conn)
+
+	err = sqlitex.Execute(
+		conn,
+		`SELECT filename, kind FROM item_images WHERE item_id = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				filename := stmt.ColumnText(0)
+				kind := stmt.ColumnInt(1)
+				ii[ItemImageKind(kind)] = filename
+				return nil
+			},
+			Args: []any{itemID},
+		},
+	)
+	return ii, err
+}
@@ -0,0 +1,191 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/oklog/ulid"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// Merge moves everything from a duplicate item into another item and then
+// deletes the duplicate. A tombstone is left behind so the duplicate's ID can
+// be redirected to the item it was merged into.
+//
+// Unless revisits are allowed, a user who has given kudos to both items keeps
+// only their newest kudo across the two, so there's one per user per item.
+// Kudos from users who only gave kudos to one of the items are all kept, since
+// they may be revisits recorded while revisits were allowed.
+func (m *ItemModel) Merge(
+	ctx context.Context,
+	from ulid.ULID,
+	into ulid.ULID,
+	merger_username string,
+	revisits bool,
+) (err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
+	var count int
+	err = sqlitex.Execute(
+		conn,
+		`SELECT count(*) FROM items WHERE id IN (?, ?)`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				count = stmt.ColumnInt(0)
+				return nil
+			},
+			Args: []any{from, into},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if count != 2 {
+		return ErrNoRecord
+	}
+
+	// Settle conflicts where a user has given kudos to both items.
+	if !revisits {
+		const stale = `SELECT id FROM kudos AS k
+		WHERE k.item_id IN (?1, ?2)
+		AND EXISTS (
+			SELECT 1 FROM kudos
+			WHERE item_id = ?1 AND creator_username = k.creator_username
+		)
+		AND EXISTS (
+			SELECT 1 FROM kudos
+			WHERE item_id = ?2 AND creator_username = k.creator_username
+		)
+		AND k.id < (
+			SELECT max(id) FROM kudos
+			WHERE item_id IN (?1, ?2) AND creator_username = k.creator_username
+		)`
+		for _, table := range kudoDependents {
+			err = sqlitex.Execute(
+				conn,
+				`DELETE FROM `+table+` WHERE kudo_id IN (`+stale+`)`,
+				&sqlitex.ExecOptions{Args: []any{from, into}},
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = sqlitex.Execute(
+			conn,
+			`DELETE FROM kudos WHERE id IN (`+stale+`)`,
+			&sqlitex.ExecOptions{Args: []any{from, into}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE kudos SET item_id = ? WHERE item_id = ?`,
+		&sqlitex.ExecOptions{Args: []any{into, from}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Recently deleted kudos are restored to the new item.
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE deleted_kudos SET item_id = ? WHERE item_id = ?`,
+		&sqlitex.ExecOptions{Args: []any{into, from}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Anything which was merged into the duplicate now points to the new item.
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE item_redirects SET target_id = ? WHERE target_id = ?`,
+		&sqlitex.ExecOptions{Args: []any{into, from}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Keep the duplicate's cover if the item didn't have one.
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE OR IGNORE item_images SET item_id = ? WHERE item_id = ?`,
+		&sqlitex.ExecOptions{Args: []any{into, from}},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`INSERT INTO item_redirects (id, target_id, merger_username, merged)
+		VALUES (?, ?, ?, ?)`,
+		&sqlitex.ExecOptions{Args: []any{
+			from,
+			into,
+			merger_username,
+			time.Now().Unix(),
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Deleting the item also removes its revisions, images and search entry.
+	return sqlitex.Execute(
+		conn,
+		`DELETE FROM items WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{from}},
+	)
+}
+
+// Redirect returns the ID of the item a merged item was merged into.
+func (m *ItemModel) Redirect(
+	ctx context.Context,
+	id ulid.ULID,
+) (ulid.ULID, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+	defer m.DB.Put(conn)
+
+	var target ulid.ULID
+	var found bool
+	err = sqlitex.Execute(
+		conn,
+		`SELECT target_id FROM item_redirects WHERE id = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				found = true
+				target, err = ulid.Parse(stmt.ColumnText(0))
+				return err
+			},
+			Args: []any{id},
+		},
+	)
+	if err != nil {
+		return target, err
+	}
+	if !found {
+		return target, ErrNoRecord
+	}
+	return target, nil
+}
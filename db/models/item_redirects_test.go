@@ -0,0 +1,114 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.sr.ht/~kota/kudoer/db"
+	"git.sr.ht/~kota/kudoer/db/models"
+	"github.com/oklog/ulid"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+func TestMerge(t *testing.T) {
+	ctx := context.Background()
+	pool, err := db.Open(filepath.Join(t.TempDir(), "kudoer.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	users := &models.UserModel{DB: pool}
+	items := &models.ItemModel{DB: pool}
+	kudos := &models.KudoModel{DB: pool}
+
+	for _, username := range []string{"alice", "bob"} {
+		err = users.Register(ctx, username, username, "", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	into, err := items.Insert(ctx, "alice", "Dune", "", "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := items.Insert(ctx, "alice", "Dune", "", "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Kudo IDs are ordered by time, so each one is made a little later.
+	kudo := func(item ulid.ULID, username string) ulid.ULID {
+		t.Helper()
+		time.Sleep(2 * time.Millisecond)
+		id, err := kudos.Insert(
+			ctx,
+			item,
+			username,
+			0,
+			0,
+			"",
+			"",
+			models.VisibilityPublic,
+			nil,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	// Alice's kudo on the duplicate is newer than the one on the item. Bob
+	// recorded revisits of the item while they were allowed.
+	older := kudo(into, "alice")
+	newer := kudo(from, "alice")
+	bobFirst := kudo(into, "bob")
+	bobSecond := kudo(into, "bob")
+
+	err = items.Merge(ctx, from, into, "alice", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := pool.Take(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Put(conn)
+
+	got := map[string][]string{}
+	err = sqlitex.Execute(
+		conn,
+		`SELECT creator_username, id FROM kudos WHERE item_id = ? ORDER BY id`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				username := stmt.ColumnText(0)
+				got[username] = append(got[username], stmt.ColumnText(1))
+				return nil
+			},
+			Args: []any{into},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got["alice"]) != 1 || got["alice"][0] != newer.String() {
+		t.Fatalf(
+			"got alice's kudos %v want only the newer %v, not %v",
+			got["alice"],
+			newer,
+			older,
+		)
+	}
+	if len(got["bob"]) != 2 ||
+		got["bob"][0] != bobFirst.String() ||
+		got["bob"][1] != bobSecond.String() {
+		t.Fatalf("got bob's kudos %v want both revisits", got["bob"])
+	}
+}
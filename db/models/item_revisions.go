@@ -0,0 +1,140 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/oklog/ulid"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// ItemRevision is a snapshot of an item's information as it was after an edit.
+// The time of the edit is stored in the ID.
+type ItemRevision struct {
+	ID             ulid.ULID
+	ItemID         ulid.ULID
+	EditorUsername string
+	Name           string
+	Description    string
+	Source         string
+	Kind           string
+	Attributes     map[string]string
+}
+
+// insertRevision records a revision using an existing connection so it can be
+// part of a larger transaction.
+func insertRevision(conn *sqlite.Conn, r ItemRevision) error {
+	// Attributes are stored as a JSON object since they're only ever read
+	// back as a whole.
+	attributes, err := json.Marshal(r.Attributes)
+	if err != nil {
+		return err
+	}
+
+	return sqlitex.Execute(
+		conn,
+		`INSERT INTO item_revisions
+		(id, item_id, editor_username, name, description, source, kind, attributes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		&sqlitex.ExecOptions{Args: []any{
+			r.ID,
+			r.ItemID,
+			r.EditorUsername,
+			r.Name,
+			r.Description,
+			r.Source,
+			r.Kind,
+			string(attributes),
+		}},
+	)
+}
+
+// Revisions returns every revision of an item.
+// The list is from newest to oldest.
+func (m *ItemModel) Revisions(
+	ctx context.Context,
+	itemID ulid.ULID,
+) ([]ItemRevision, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.DB.Put(conn)
+
+	var revisions []ItemRevision
+	err = sqlitex.Execute(conn,
+		`SELECT id, editor_username, name, description, source, kind,
+		attributes FROM item_revisions WHERE item_id = ? ORDER BY id DESC`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				var r ItemRevision
+
+				id, err := ulid.Parse(stmt.ColumnText(0))
+				if err != nil {
+					return err
+				}
+				r.ID = id
+				r.ItemID = itemID
+
+				r.EditorUsername = stmt.ColumnText(1)
+				r.Name = stmt.ColumnText(2)
+				r.Description = stmt.ColumnText(3)
+				r.Source = stmt.ColumnText(4)
+				r.Kind = stmt.ColumnText(5)
+
+				err = json.Unmarshal([]byte(stmt.ColumnText(6)), &r.Attributes)
+				if err != nil {
+					return err
+				}
+
+				revisions = append(revisions, r)
+				return nil
+			},
+			Args: []any{itemID},
+		})
+	return revisions, err
+}
+
+// Revision returns a single item revision.
+func (m *ItemModel) Revision(
+	ctx context.Context,
+	id ulid.ULID,
+) (ItemRevision, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return ItemRevision{}, err
+	}
+	defer m.DB.Put(conn)
+
+	var r ItemRevision
+	err = sqlitex.Execute(conn,
+		`SELECT item_id, editor_username, name, description, source, kind,
+		attributes FROM item_revisions WHERE id = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				itemID, err := ulid.Parse(stmt.ColumnText(0))
+				if err != nil {
+					return err
+				}
+				r.ID = id
+				r.ItemID = itemID
+
+				r.EditorUsername = stmt.ColumnText(1)
+				r.Name = stmt.ColumnText(2)
+				r.Description = stmt.ColumnText(3)
+				r.Source = stmt.ColumnText(4)
+				r.Kind = stmt.ColumnText(5)
+
+				return json.Unmarshal([]byte(stmt.ColumnText(6)), &r.Attributes)
+			},
+			Args: []any{id},
+		})
+
+	if r.ID.Compare(id) != 0 {
+		return r, ErrNoRecord
+	}
+	return r, err
+}
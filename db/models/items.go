@@ -20,6 +20,18 @@ type Item struct {
 	Name            string
 	Description     string
 	Source          string
+	Kind            string
+
+	// Cover is the filename of the small variant of the item's cover image.
+	// It is only filled in by List.
+	Cover string
+
+	// Kudos is how many kudos the viewer may see for the item.
+	// It is only filled in by List.
+	Kudos int
+
+	// Attributes maps the attribute keys of the item's kind to their values.
+	Attributes map[string]string
 }
 
 // ItemModel handles item storage.
@@ -37,7 +49,7 @@ func (m *ItemModel) Info(ctx context.Context, uuid ulid.ULID) (Item, error) {
 
 	var i Item
 	err = sqlitex.Execute(conn,
-		`SELECT creator_username, name, description, source FROM items WHERE id = ?`,
+		`SELECT creator_username, name, description, source, kind FROM items WHERE id = ?`,
 		&sqlitex.ExecOptions{
 			ResultFunc: func(stmt *sqlite.Stmt) error {
 				i.ID = uuid
@@ -46,15 +58,30 @@ func (m *ItemModel) Info(ctx context.Context, uuid ulid.ULID) (Item, error) {
 				i.Name = stmt.ColumnText(1)
 				i.Description = stmt.ColumnText(2)
 				i.Source = stmt.ColumnText(3)
+				i.Kind = stmt.ColumnText(4)
 				return nil
 			},
 			Args: []any{uuid},
 		})
+	if err != nil {
+		return i, err
+	}
 
 	if i.ID.Compare(uuid) != 0 {
 		fmt.Println("uuid", uuid.String(), i.ID.String())
 		return i, ErrNoRecord
 	}
+
+	i.Attributes = make(map[string]string)
+	err = sqlitex.Execute(conn,
+		`SELECT key, value FROM item_attributes WHERE item_id = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				i.Attributes[stmt.ColumnText(0)] = stmt.ColumnText(1)
+				return nil
+			},
+			Args: []any{uuid},
+		})
 	return i, err
 }
 
@@ -113,7 +140,8 @@ func (m *ItemModel) ListInfo(
 	// index to sort the output.
 	var items []Item
 	err = sqlitex.Execute(conn,
-		`SELECT items.id, items.creator_username, items.name, items.description
+		`SELECT items.id, items.creator_username, items.name, items.description,
+		items.kind
 		FROM temp.sorted_ids JOIN items ON temp.sorted_ids.id = items.id
 		ORDER BY temp.sorted_ids.idx;`,
 		&sqlitex.ExecOptions{
@@ -128,6 +156,7 @@ func (m *ItemModel) ListInfo(
 				i.CreatorUsername = stmt.ColumnText(1)
 				i.Name = stmt.ColumnText(2)
 				i.Description = stmt.ColumnText(3)
+				i.Kind = stmt.ColumnText(4)
 				items = append(items, i)
 				return nil
 			},
@@ -141,14 +170,18 @@ func (m *ItemModel) ListInfo(
 }
 
 // Insert adds a new item to the database.
+// The item's initial revision is recorded with the same ID as the item.
 func (m *ItemModel) Insert(
 	ctx context.Context,
 	creator_username string,
 	name string,
 	description string,
-) (ulid.ULID, error) {
+	source string,
+	kind string,
+	attributes map[string]string,
+) (uuid ulid.ULID, err error) {
 	ms := ulid.Timestamp(time.Now())
-	uuid, err := ulid.New(ms, rand.Reader)
+	uuid, err = ulid.New(ms, rand.Reader)
 	if err != nil {
 		return uuid, err
 	}
@@ -159,10 +192,222 @@ func (m *ItemModel) Insert(
 	}
 	defer m.DB.Put(conn)
 
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return uuid, err
+	}
+	defer endFn(&err)
+
 	err = sqlitex.Execute(
 		conn,
-		`INSERT INTO items (id, creator_username, name, description) VALUES (?, ?, ?, ?)`,
-		&sqlitex.ExecOptions{Args: []any{uuid, creator_username, name, description}},
+		`INSERT INTO items (id, creator_username, name, description, source, kind) VALUES (?, ?, ?, ?, ?, ?)`,
+		&sqlitex.ExecOptions{Args: []any{uuid, creator_username, name, description, source, kind}},
 	)
+	if err != nil {
+		return uuid, sourceExists(err)
+	}
+
+	err = setAttributes(conn, uuid, attributes)
+	if err != nil {
+		return uuid, err
+	}
+
+	err = insertRevision(conn, ItemRevision{
+		ID:             uuid,
+		ItemID:         uuid,
+		EditorUsername: creator_username,
+		Name:           name,
+		Description:    description,
+		Source:         source,
+		Kind:           kind,
+		Attributes:     attributes,
+	})
 	return uuid, err
 }
+
+// sourceExists converts unique constraint errors on an item's source into
+// ErrSourceExists.
+func sourceExists(err error) error {
+	if sqlite.ErrCode(err) == sqlite.ResultConstraintUnique &&
+		strings.HasSuffix(err.Error(), "items.source") {
+		return ErrSourceExists
+	}
+	return err
+}
+
+// FindSource returns the ID of the item with a given source URL.
+func (m *ItemModel) FindSource(
+	ctx context.Context,
+	source string,
+) (ulid.ULID, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+	defer m.DB.Put(conn)
+
+	var id ulid.ULID
+	var found bool
+	err = sqlitex.Execute(conn,
+		`SELECT id FROM items WHERE source = ? AND source != ''`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				found = true
+				id, err = ulid.Parse(stmt.ColumnText(0))
+				return err
+			},
+			Args: []any{source},
+		})
+	if err != nil {
+		return id, err
+	}
+	if !found {
+		return id, ErrNoRecord
+	}
+	return id, nil
+}
+
+// Update changes an item's information and records the change as a new
+// revision by the given editor.
+func (m *ItemModel) Update(
+	ctx context.Context,
+	id ulid.ULID,
+	editor_username string,
+	name string,
+	description string,
+	source string,
+	kind string,
+	attributes map[string]string,
+) (err error) {
+	ms := ulid.Timestamp(time.Now())
+	revisionID, err := ulid.New(ms, rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE items SET name = ?, description = ?, source = ?, kind = ? WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{name, description, source, kind, id}},
+	)
+	if err != nil {
+		return sourceExists(err)
+	}
+	if conn.Changes() == 0 {
+		return ErrNoRecord
+	}
+
+	err = setAttributes(conn, id, attributes)
+	if err != nil {
+		return err
+	}
+
+	return insertRevision(conn, ItemRevision{
+		ID:             revisionID,
+		ItemID:         id,
+		EditorUsername: editor_username,
+		Name:           name,
+		Description:    description,
+		Source:         source,
+		Kind:           kind,
+		Attributes:     attributes,
+	})
+}
+
+// setAttributes replaces all of an item's attributes using an existing
+// connection so it can be part of a larger transaction.
+func setAttributes(
+	conn *sqlite.Conn,
+	id ulid.ULID,
+	attributes map[string]string,
+) error {
+	err := sqlitex.Execute(
+		conn,
+		`DELETE FROM item_attributes WHERE item_id = ?`,
+		&sqlitex.ExecOptions{Args: []any{id}},
+	)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range attributes {
+		err = sqlitex.Execute(
+			conn,
+			`INSERT INTO item_attributes (item_id, key, value) VALUES (?, ?, ?)`,
+			&sqlitex.ExecOptions{Args: []any{id, key, value}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns items from newest to oldest.
+// If a kind is given only items of that kind are listed.
+func (m *ItemModel) List(
+	ctx context.Context,
+	kind string,
+	viewer string,
+	page int,
+) ([]Item, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.DB.Put(conn)
+
+	var items []Item
+	err = sqlitex.Execute(conn,
+		`SELECT items.id, items.creator_username, items.name,
+			items.description, items.source, items.kind, item_images.filename,
+			(
+				SELECT count(*) FROM kudos
+				WHERE kudos.item_id = items.id AND `+visibleNewestKudo+`
+			)
+		FROM items
+		LEFT JOIN item_images
+			ON items.id = item_images.item_id
+			AND item_images.kind = 1
+		WHERE :kind = '' OR items.kind = :kind
+		ORDER BY items.id DESC LIMIT :limit OFFSET :offset`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				var i Item
+				uuid, err := ulid.Parse(stmt.ColumnText(0))
+				if err != nil {
+					return err
+				}
+				i.ID = uuid
+
+				i.CreatorUsername = stmt.ColumnText(1)
+				i.Name = stmt.ColumnText(2)
+				i.Description = stmt.ColumnText(3)
+				i.Source = stmt.ColumnText(4)
+				i.Kind = stmt.ColumnText(5)
+				i.Cover = stmt.ColumnText(6)
+				i.Kudos = stmt.ColumnInt(7)
+				items = append(items, i)
+				return nil
+			},
+			Named: map[string]any{
+				":kind":   kind,
+				":viewer": viewer,
+				":limit":  PageSize,
+				":offset": offset(page),
+			},
+		})
+	return items, err
+}
@@ -0,0 +1,98 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"github.com/oklog/ulid"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// syncMentions makes the stored mentions of a kudo match the given usernames
+// using an existing connection so it can be part of a larger transaction.
+// Unknown usernames are skipped. Newly mentioned users are notified, and
+// notifications for mentions which were removed are taken back.
+func syncMentions(
+	conn *sqlite.Conn,
+	kudoID ulid.ULID,
+	creator_username string,
+	usernames []string,
+) error {
+	old := make(map[string]bool)
+	err := sqlitex.Execute(
+		conn,
+		`SELECT username FROM kudo_mentions WHERE kudo_id = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				old[stmt.ColumnText(0)] = true
+				return nil
+			},
+			Args: []any{kudoID},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	mentioned := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		mentioned[username] = true
+		if old[username] {
+			continue
+		}
+
+		err = sqlitex.Execute(
+			conn,
+			`INSERT INTO kudo_mentions (kudo_id, username)
+			SELECT ?, username FROM users WHERE username = ?`,
+			&sqlitex.ExecOptions{Args: []any{kudoID, username}},
+		)
+		if err != nil {
+			return err
+		}
+		if conn.Changes() == 0 || username == creator_username {
+			continue
+		}
+
+		err = insertNotification(
+			conn,
+			username,
+			NotificationMention,
+			creator_username,
+			kudoID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for username := range old {
+		if mentioned[username] {
+			continue
+		}
+
+		err = sqlitex.Execute(
+			conn,
+			`DELETE FROM kudo_mentions WHERE kudo_id = ? AND username = ?`,
+			&sqlitex.ExecOptions{Args: []any{kudoID, username}},
+		)
+		if err != nil {
+			return err
+		}
+
+		err = sqlitex.Execute(
+			conn,
+			`DELETE FROM notifications
+			WHERE kudo_id = ? AND username = ? AND kind = ?`,
+			&sqlitex.ExecOptions{Args: []any{
+				kudoID,
+				username,
+				NotificationMention,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"time"
+
+	"github.com/oklog/ulid"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// MaxReplyDepth is how deeply replies may be nested. Replies to a kudo itself
+// are at a depth of one.
+const MaxReplyDepth = 8
+
+// Reply is a response to a kudo or to another reply.
+type Reply struct {
+	ID                 ulid.ULID
+	KudoID             ulid.ULID
+	ParentID           ulid.ULID // Zero when replying to the kudo itself.
+	CreatorUsername    string
+	CreatorDisplayName string
+	Body               string
+	Deleted            bool
+
+	// Replies to this reply from oldest to newest.
+	Replies []*Reply
+}
+
+// Replies returns the tree of replies to a kudo.
+// Each level of the tree is sorted from oldest to newest.
+func (m *KudoModel) Replies(
+	ctx context.Context,
+	kudoID ulid.ULID,
+) ([]*Reply, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.DB.Put(conn)
+
+	var all []*Reply
+	byID := make(map[ulid.ULID]*Reply)
+	err = sqlitex.Execute(conn,
+		`SELECT kudo_replies.id, kudo_replies.parent_id,
+			kudo_replies.creator_username, users.displayname,
+			kudo_replies.body, kudo_replies.deleted
+		FROM kudo_replies
+		JOIN users
+			ON kudo_replies.creator_username = users.username
+		WHERE kudo_replies.kudo_id = ?
+		ORDER BY kudo_replies.id`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				var r Reply
+				var err error
+				r.ID, err = ulid.Parse(stmt.ColumnText(0))
+				if err != nil {
+					return err
+				}
+				if parent := stmt.ColumnText(1); parent != "" {
+					r.ParentID, err = ulid.Parse(parent)
+					if err != nil {
+						return err
+					}
+				}
+				r.KudoID = kudoID
+				r.CreatorUsername = stmt.ColumnText(2)
+				r.CreatorDisplayName = stmt.ColumnText(3)
+				r.Body = stmt.ColumnText(4)
+				r.Deleted = stmt.ColumnBool(5)
+
+				all = append(all, &r)
+				byID[r.ID] = &r
+				return nil
+			},
+			Args: []any{kudoID},
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// Replies are sorted by ID so a parent is always seen before its children.
+	var roots []*Reply
+	for _, r := range all {
+		parent, ok := byID[r.ParentID]
+		if !ok {
+			roots = append(roots, r)
+			continue
+		}
+		parent.Replies = append(parent.Replies, r)
+	}
+	return roots, nil
+}
+
+// InsertReply adds a reply to a kudo. A zero parentID replies to the kudo
+// itself, otherwise the parent must be a reply to the same kudo. If the parent
+// is already nested MaxReplyDepth deep ErrReplyTooDeep is returned.
+func (m *KudoModel) InsertReply(
+	ctx context.Context,
+	kudoID ulid.ULID,
+	parentID ulid.ULID,
+	creator_username string,
+	body string,
+) (uuid ulid.ULID, err error) {
+	uuid, err = ulid.New(ulid.Timestamp(time.Now()), rand.Reader)
+	if err != nil {
+		return uuid, err
+	}
+
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return uuid, err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return uuid, err
+	}
+	defer endFn(&err)
+
+	// The replier must be able to see the kudo they reply to.
+	var found bool
+	query := `SELECT kudos.id FROM kudos
+	WHERE kudos.id = :kudo AND ` + visible("kudos")
+	named := map[string]any{":kudo": kudoID, ":viewer": creator_username}
+	if parentID != (ulid.ULID{}) {
+		query += ` AND EXISTS (
+			SELECT 1 FROM kudo_replies
+			WHERE kudo_replies.id = :parent AND kudo_replies.kudo_id = kudos.id
+			AND kudo_replies.deleted = 0
+		)`
+		named[":parent"] = parentID
+	}
+	err = sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			found = true
+			return nil
+		},
+		Named: named,
+	})
+	if err != nil {
+		return uuid, err
+	}
+	if !found {
+		return uuid, ErrNoRecord
+	}
+
+	var parent string
+	if parentID != (ulid.ULID{}) {
+		parent = parentID.String()
+
+		// Walk up from the parent to find how deep it's nested.
+		var depth int
+		err = sqlitex.Execute(
+			conn,
+			`WITH RECURSIVE ancestors (id, parent_id, depth) AS (
+				SELECT id, parent_id, 1 FROM kudo_replies WHERE id = :parent
+				UNION ALL
+				SELECT kudo_replies.id, kudo_replies.parent_id, ancestors.depth + 1
+				FROM kudo_replies
+				JOIN ancestors ON kudo_replies.id = ancestors.parent_id
+				WHERE ancestors.depth < :max
+			)
+			SELECT max(depth) FROM ancestors`,
+			&sqlitex.ExecOptions{
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					depth = stmt.ColumnInt(0)
+					return nil
+				},
+				Named: map[string]any{
+					":parent": parentID,
+					":max":    MaxReplyDepth,
+				},
+			},
+		)
+		if err != nil {
+			return uuid, err
+		}
+		if depth >= MaxReplyDepth {
+			return uuid, ErrReplyTooDeep
+		}
+	}
+	err = sqlitex.Execute(
+		conn,
+		`INSERT INTO kudo_replies (id, kudo_id, parent_id, creator_username, body)
+		VALUES (?, ?, ?, ?, ?)`,
+		&sqlitex.ExecOptions{Args: []any{
+			uuid,
+			kudoID,
+			parent,
+			creator_username,
+			body,
+		}},
+	)
+	return uuid, err
+}
+
+// DeleteReply removes a reply's body and returns the ID of the kudo it belongs
+// to. Only the reply's author or the author of the kudo may delete a reply.
+// Replies to a deleted reply are kept.
+func (m *KudoModel) DeleteReply(
+	ctx context.Context,
+	id ulid.ULID,
+	username string,
+) (kudoID ulid.ULID, err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return kudoID, err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return kudoID, err
+	}
+	defer endFn(&err)
+
+	var found bool
+	err = sqlitex.Execute(
+		conn,
+		`SELECT kudo_replies.kudo_id FROM kudo_replies
+		JOIN kudos
+			ON kudo_replies.kudo_id = kudos.id
+		WHERE kudo_replies.id = ?1 AND kudo_replies.deleted = 0 AND (
+			kudo_replies.creator_username = ?2 OR kudos.creator_username = ?2
+		)`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				found = true
+				kudoID, err = ulid.Parse(stmt.ColumnText(0))
+				return err
+			},
+			Args: []any{id, username},
+		},
+	)
+	if err != nil {
+		return kudoID, err
+	}
+	if !found {
+		return kudoID, ErrNoRecord
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE kudo_replies SET body = '', deleted = 1 WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{id}},
+	)
+	return kudoID, err
+}
@@ -0,0 +1,77 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+
+	"github.com/oklog/ulid"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// KudoRevision is a snapshot of a kudo as it was after an edit.
+// The time of the edit is stored in the ID.
+type KudoRevision struct {
+	ID     ulid.ULID
+	KudoID ulid.ULID
+	Frame  int
+	Emoji  int
+	Body   string
+
+	Warning string
+}
+
+// insertKudoRevision records a revision using an existing connection so it can
+// be part of a larger transaction.
+func insertKudoRevision(conn *sqlite.Conn, r KudoRevision) error {
+	return sqlitex.Execute(
+		conn,
+		`INSERT INTO kudo_revisions (id, kudo_id, frame, emoji, body, warning)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		&sqlitex.ExecOptions{Args: []any{
+			r.ID,
+			r.KudoID,
+			r.Frame,
+			r.Emoji,
+			r.Body,
+			r.Warning,
+		}},
+	)
+}
+
+// Revisions returns every revision of a kudo from newest to oldest.
+func (m *KudoModel) Revisions(
+	ctx context.Context,
+	kudoID ulid.ULID,
+) ([]KudoRevision, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.DB.Put(conn)
+
+	var revisions []KudoRevision
+	err = sqlitex.Execute(conn,
+		`SELECT id, frame, emoji, body, warning FROM kudo_revisions
+		WHERE kudo_id = ? ORDER BY id DESC`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				var r KudoRevision
+				id, err := ulid.Parse(stmt.ColumnText(0))
+				if err != nil {
+					return err
+				}
+				r.ID = id
+				r.KudoID = kudoID
+				r.Frame = stmt.ColumnInt(1)
+				r.Emoji = stmt.ColumnInt(2)
+				r.Body = stmt.ColumnText(3)
+				r.Warning = stmt.ColumnText(4)
+				revisions = append(revisions, r)
+				return nil
+			},
+			Args: []any{kudoID},
+		})
+	return revisions, err
+}
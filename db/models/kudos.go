@@ -5,6 +5,8 @@ package models
 import (
 	"context"
 	"crypto/rand"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/oklog/ulid"
@@ -16,12 +18,43 @@ type Kudo struct {
 	ID                 ulid.ULID
 	ItemID             ulid.ULID
 	ItemName           string
+	ItemCover          string
 	CreatorUsername    string
 	CreatorDisplayName string
 	CreatorPic         string
 	Frame              int
 	Emoji              int
 	Body               string
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	ReplyCount         int
+
+	// Warning is an optional content warning label. The body is hidden
+	// behind it until the reader chooses to open it.
+	Warning string
+
+	// Visits is how many kudos the creator has given to the item.
+	// There is only ever one unless revisits are allowed.
+	Visits int
+
+	Visibility Visibility
+
+	// Mentions are the users mentioned in the body who have an account.
+	Mentions []string
+}
+
+// Visibility controls who is allowed to see a kudo.
+type Visibility int
+
+const (
+	VisibilityPublic Visibility = iota
+	VisibilityFollowers
+	VisibilityPrivate
+)
+
+// Edited reports if the kudo was changed after it was given.
+func (k Kudo) Edited() bool {
+	return k.UpdatedAt.After(k.CreatedAt)
 }
 
 // KudoModel handles kudo storage.
@@ -38,6 +71,125 @@ func offset(page int) int {
 	return (page - 1) * PageSize
 }
 
+// visible limits a query to the kudos in the given table which the :viewer
+// may see. Public kudos are seen by everyone, followers-only kudos by the
+// creator's followers, and private kudos only by their creator.
+func visible(table string) string {
+	return fmt.Sprintf(`(%[1]s.visibility = %[2]d
+	OR %[1]s.creator_username = :viewer
+	OR (%[1]s.visibility = %[3]d AND EXISTS (
+		SELECT 1 FROM users_following
+		WHERE users_following.username = :viewer
+		AND users_following.following_username = %[1]s.creator_username
+	)))`, table, VisibilityPublic, VisibilityFollowers)
+}
+
+// kudoColumns are the columns read by scanKudo. They require the tables joined
+// in kudoJoins and a :viewer parameter.
+var kudoColumns = `kudos.id, kudos.item_id, items.name, item_images.filename,
+	kudos.creator_username, users.displayname, profile_pictures.filename,
+	kudos.frame, kudos.emoji, kudos.body, kudos.created_at, kudos.updated_at,
+	(
+		SELECT count(*) FROM kudo_replies
+		WHERE kudo_replies.kudo_id = kudos.id AND kudo_replies.deleted = 0
+	),
+	(
+		SELECT count(*) FROM kudos AS visits
+		WHERE visits.item_id = kudos.item_id
+		AND visits.creator_username = kudos.creator_username
+		AND ` + visible("visits") + `
+	),
+	kudos.visibility, kudos.warning,
+	(
+		SELECT group_concat(username, ' ') FROM kudo_mentions
+		WHERE kudo_mentions.kudo_id = kudos.id
+	)`
+
+// kudoJoins joins the tables needed to fill in a kudo's item and creator.
+const kudoJoins = `
+JOIN users
+	ON kudos.creator_username = users.username
+LEFT JOIN profile_pictures
+	ON kudos.creator_username = profile_pictures.username
+	AND profile_pictures.kind = 1
+LEFT JOIN item_images
+	ON kudos.item_id = item_images.item_id
+	AND item_images.kind = 1
+JOIN items
+	ON kudos.item_id = items.id`
+
+// visibleNewestKudo limits a query to kudos the :viewer may see, and only the
+// newest of those a user has given to each item, so revisits only show up
+// once in lists.
+var visibleNewestKudo = visible("kudos") + ` AND kudos.id = (
+	SELECT max(newer.id) FROM kudos AS newer
+	WHERE newer.item_id = kudos.item_id
+	AND newer.creator_username = kudos.creator_username
+	AND ` + visible("newer") + `
+)`
+
+// scanKudo reads a kudo from a row selected with kudoColumns.
+func scanKudo(stmt *sqlite.Stmt) (Kudo, error) {
+	var k Kudo
+	var err error
+
+	k.ID, err = ulid.Parse(stmt.ColumnText(0))
+	if err != nil {
+		return k, err
+	}
+
+	k.ItemID, err = ulid.Parse(stmt.ColumnText(1))
+	if err != nil {
+		return k, err
+	}
+
+	k.ItemName = stmt.ColumnText(2)
+	k.ItemCover = stmt.ColumnText(3)
+	k.CreatorUsername = stmt.ColumnText(4)
+	k.CreatorDisplayName = stmt.ColumnText(5)
+	k.CreatorPic = stmt.ColumnText(6)
+	k.Frame = stmt.ColumnInt(7)
+	k.Emoji = stmt.ColumnInt(8)
+	k.Body = stmt.ColumnText(9)
+
+	// Kudos given before timestamps were stored only have their ID's time.
+	k.CreatedAt = ulid.Time(k.ID.Time())
+	if created := stmt.ColumnInt64(10); created != 0 {
+		k.CreatedAt = time.Unix(created, 0)
+	}
+	k.UpdatedAt = k.CreatedAt
+	if updated := stmt.ColumnInt64(11); updated != 0 {
+		k.UpdatedAt = time.Unix(updated, 0)
+	}
+	k.ReplyCount = stmt.ColumnInt(12)
+	k.Visits = stmt.ColumnInt(13)
+	k.Visibility = Visibility(stmt.ColumnInt(14))
+	k.Warning = stmt.ColumnText(15)
+	k.Mentions = strings.Fields(stmt.ColumnText(16))
+	return k, nil
+}
+
+// listKudos runs a query selecting kudoColumns and returns every kudo found.
+func listKudos(
+	conn *sqlite.Conn,
+	query string,
+	named map[string]any,
+) ([]Kudo, error) {
+	var kudos []Kudo
+	err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			k, err := scanKudo(stmt)
+			if err != nil {
+				return err
+			}
+			kudos = append(kudos, k)
+			return nil
+		},
+		Named: named,
+	})
+	return kudos, err
+}
+
 // Following returns a list of all kudos from everyone a user is following.
 func (m *KudoModel) Following(
 	ctx context.Context,
@@ -50,63 +202,24 @@ func (m *KudoModel) Following(
 	}
 	defer m.DB.Put(conn)
 
-	limit := PageSize
-	offset := offset(page)
-
-	var kudos []Kudo
-	err = sqlitex.Execute(conn,
-		`
-SELECT kudos.id, kudos.item_id, items.name, kudos.creator_username,
-	users.displayname, profile_pictures.filename, kudos.frame,
-	kudos.emoji, kudos.body
+	return listKudos(conn,
+		`SELECT `+kudoColumns+`
 FROM users_following
 JOIN kudos
-	ON users_following.following_username = kudos.creator_username
-JOIN users
-	ON users_following.following_username = users.username
-LEFT JOIN profile_pictures
-	ON users_following.following_username = profile_pictures.username
-	AND profile_pictures.kind = 1
-JOIN items
-	ON kudos.item_id = items.id
-WHERE users_following.username = ?
-ORDER BY kudos.id DESC LIMIT ? OFFSET ?`,
-		&sqlitex.ExecOptions{
-			ResultFunc: func(stmt *sqlite.Stmt) error {
-				var k Kudo
-
-				id := stmt.ColumnText(0)
-				k.ID, err = ulid.Parse(id)
-				if err != nil {
-					return err
-				}
-
-				item_id := stmt.ColumnText(1)
-				k.ItemID, err = ulid.Parse(item_id)
-				if err != nil {
-					return err
-				}
-
-				k.ItemName = stmt.ColumnText(2)
-				k.CreatorUsername = stmt.ColumnText(3)
-				k.CreatorDisplayName = stmt.ColumnText(4)
-				k.CreatorPic = stmt.ColumnText(5)
-				k.Frame = stmt.ColumnInt(6)
-				k.Emoji = stmt.ColumnInt(7)
-				k.Body = stmt.ColumnText(8)
-
-				kudos = append(kudos, k)
-
-				return nil
-			},
-			Args: []any{username, limit, offset},
+	ON users_following.following_username = kudos.creator_username`+kudoJoins+`
+WHERE users_following.username = :viewer AND `+visibleNewestKudo+`
+ORDER BY kudos.id DESC LIMIT :limit OFFSET :offset`,
+		map[string]any{
+			":viewer": username,
+			":limit":  PageSize,
+			":offset": offset(page),
 		})
-	return kudos, err
 }
 
-// All returns a list of all kudos by recency.
+// All returns a list of all kudos the viewer may see by recency.
 func (m *KudoModel) All(
 	ctx context.Context,
+	viewer string,
 	page int,
 ) ([]Kudo, error) {
 	conn, err := m.DB.Take(ctx)
@@ -115,62 +228,24 @@ func (m *KudoModel) All(
 	}
 	defer m.DB.Put(conn)
 
-	limit := PageSize
-	offset := offset(page)
-
-	var kudos []Kudo
-	err = sqlitex.Execute(conn,
-		`
-SELECT kudos.id, kudos.item_id, items.name, kudos.creator_username,
-	users.displayname, profile_pictures.filename, kudos.frame,
-	kudos.emoji, kudos.body
-FROM kudos
-JOIN users
-	ON kudos.creator_username = users.username
-LEFT JOIN profile_pictures
-	ON kudos.creator_username = profile_pictures.username
-	AND profile_pictures.kind = 1
-JOIN items
-ON kudos.item_id = items.id
-ORDER BY kudos.id DESC LIMIT ? OFFSET ?`,
-		&sqlitex.ExecOptions{
-			ResultFunc: func(stmt *sqlite.Stmt) error {
-				var k Kudo
-
-				id := stmt.ColumnText(0)
-				k.ID, err = ulid.Parse(id)
-				if err != nil {
-					return err
-				}
-
-				item_id := stmt.ColumnText(1)
-				k.ItemID, err = ulid.Parse(item_id)
-				if err != nil {
-					return err
-				}
-
-				k.ItemName = stmt.ColumnText(2)
-				k.CreatorUsername = stmt.ColumnText(3)
-				k.CreatorDisplayName = stmt.ColumnText(4)
-				k.CreatorPic = stmt.ColumnText(5)
-				k.Frame = stmt.ColumnInt(6)
-				k.Emoji = stmt.ColumnInt(7)
-				k.Body = stmt.ColumnText(8)
-
-				kudos = append(kudos, k)
-
-				return nil
-			},
-			Args: []any{limit, offset},
+	return listKudos(conn,
+		`SELECT `+kudoColumns+`
+FROM kudos`+kudoJoins+`
+WHERE `+visibleNewestKudo+`
+ORDER BY kudos.id DESC LIMIT :limit OFFSET :offset`,
+		map[string]any{
+			":viewer": viewer,
+			":limit":  PageSize,
+			":offset": offset(page),
 		})
-	return kudos, err
 }
 
-// Item returns all kudos for a given item.
+// Item returns all kudos the viewer may see for a given item.
 // The list is from newest to oldest.
 func (m *KudoModel) Item(
 	ctx context.Context,
 	itemID ulid.ULID,
+	viewer string,
 	page int,
 ) ([]Kudo, error) {
 	conn, err := m.DB.Take(ctx)
@@ -179,59 +254,86 @@ func (m *KudoModel) Item(
 	}
 	defer m.DB.Put(conn)
 
-	limit := PageSize
-	offset := offset(page)
-
-	var kudos []Kudo
-	err = sqlitex.Execute(conn,
-		`
-SELECT kudos.id, items.name, kudos.creator_username,
-	users.displayname, profile_pictures.filename, kudos.frame,
-	kudos.emoji, kudos.body
-FROM kudos
-JOIN users
-	ON kudos.creator_username = users.username
-LEFT JOIN profile_pictures
-	ON kudos.creator_username = profile_pictures.username
-	AND profile_pictures.kind = 1
-JOIN items
-	ON kudos.item_id = items.id WHERE kudos.item_id = ?
-ORDER BY kudos.id DESC LIMIT ? OFFSET ?`,
-		&sqlitex.ExecOptions{
-			ResultFunc: func(stmt *sqlite.Stmt) error {
-				var k Kudo
+	return listKudos(conn,
+		`SELECT `+kudoColumns+`
+FROM kudos`+kudoJoins+`
+WHERE kudos.item_id = :item AND `+visibleNewestKudo+`
+ORDER BY kudos.id DESC LIMIT :limit OFFSET :offset`,
+		map[string]any{
+			":item":   itemID,
+			":viewer": viewer,
+			":limit":  PageSize,
+			":offset": offset(page),
+		})
+}
 
-				id := stmt.ColumnText(0)
-				k.ID, err = ulid.Parse(id)
-				if err != nil {
-					return err
-				}
+// ItemUser returns the newest kudo the viewer may see for a given combination
+// of item and user if it exists.
+func (m *KudoModel) ItemUser(
+	ctx context.Context,
+	itemID ulid.ULID,
+	creator_username string,
+	viewer string,
+) (Kudo, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return Kudo{}, err
+	}
+	defer m.DB.Put(conn)
 
-				k.ItemID = itemID
+	kudos, err := listKudos(conn,
+		`SELECT `+kudoColumns+`
+FROM kudos`+kudoJoins+`
+WHERE kudos.item_id = :item AND kudos.creator_username = :creator
+AND `+visible("kudos")+`
+ORDER BY kudos.id DESC LIMIT 1`,
+		map[string]any{
+			":item":    itemID,
+			":creator": creator_username,
+			":viewer":  viewer,
+		})
+	if err != nil {
+		return Kudo{}, err
+	}
 
-				k.ItemName = stmt.ColumnText(1)
-				k.CreatorUsername = stmt.ColumnText(2)
-				k.CreatorDisplayName = stmt.ColumnText(3)
-				k.CreatorPic = stmt.ColumnText(4)
-				k.Frame = stmt.ColumnInt(5)
-				k.Emoji = stmt.ColumnInt(6)
-				k.Body = stmt.ColumnText(7)
+	if len(kudos) == 0 {
+		return Kudo{}, ErrNoRecord
+	}
+	return kudos[0], nil
+}
 
-				kudos = append(kudos, k)
+// Timeline returns every kudo the viewer may see which a user has given to an
+// item from newest to oldest.
+func (m *KudoModel) Timeline(
+	ctx context.Context,
+	itemID ulid.ULID,
+	creator_username string,
+	viewer string,
+) ([]Kudo, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return []Kudo{}, err
+	}
+	defer m.DB.Put(conn)
 
-				return nil
-			},
-			Args: []any{itemID, limit, offset},
+	return listKudos(conn,
+		`SELECT `+kudoColumns+`
+FROM kudos`+kudoJoins+`
+WHERE kudos.item_id = :item AND kudos.creator_username = :creator
+AND `+visible("kudos")+`
+ORDER BY kudos.id DESC`,
+		map[string]any{
+			":item":    itemID,
+			":creator": creator_username,
+			":viewer":  viewer,
 		})
-	return kudos, err
 }
 
-// ItemUser returns the kudo for a given combination of item and user if it
-// exists.
-func (m *KudoModel) ItemUser(
+// Get returns a single kudo if the viewer may see it.
+func (m *KudoModel) Get(
 	ctx context.Context,
-	itemID ulid.ULID,
-	creator_username string,
+	id ulid.ULID,
+	viewer string,
 ) (Kudo, error) {
 	conn, err := m.DB.Take(ctx)
 	if err != nil {
@@ -239,52 +341,30 @@ func (m *KudoModel) ItemUser(
 	}
 	defer m.DB.Put(conn)
 
-	var k Kudo
-	err = sqlitex.Execute(conn,
-		`
-SELECT kudos.id, items.name, users.displayname, profile_pictures.filename,
-	kudos.frame, kudos.emoji, kudos.body FROM kudos
-JOIN users
-	ON kudos.creator_username = users.username
-LEFT JOIN profile_pictures
-	ON kudos.creator_username = profile_pictures.username
-	AND profile_pictures.kind = 1
-JOIN items
-	ON kudos.item_id = items.id
-WHERE kudos.item_id = ? AND kudos.creator_username = ?`,
-		&sqlitex.ExecOptions{
-			ResultFunc: func(stmt *sqlite.Stmt) error {
-				id := stmt.ColumnText(0)
-				k.ID, err = ulid.Parse(id)
-				if err != nil {
-					return err
-				}
-
-				k.ItemID = itemID
-				k.ItemName = stmt.ColumnText(1)
-				k.CreatorUsername = creator_username
-				k.CreatorDisplayName = stmt.ColumnText(2)
-				k.CreatorPic = stmt.ColumnText(3)
-				k.Frame = stmt.ColumnInt(4)
-				k.Emoji = stmt.ColumnInt(5)
-				k.Body = stmt.ColumnText(6)
-
-				return nil
-			},
-			Args: []any{itemID, creator_username},
+	kudos, err := listKudos(conn,
+		`SELECT `+kudoColumns+`
+FROM kudos`+kudoJoins+`
+WHERE kudos.id = :id AND `+visible("kudos"),
+		map[string]any{
+			":id":     id,
+			":viewer": viewer,
 		})
+	if err != nil {
+		return Kudo{}, err
+	}
 
-	if k.ItemID.Compare(itemID) != 0 {
-		return k, ErrNoRecord
+	if len(kudos) == 0 {
+		return Kudo{}, ErrNoRecord
 	}
-	return k, err
+	return kudos[0], nil
 }
 
-// User returns all kudos for a given user.
+// User returns all kudos the viewer may see for a given user.
 // The list is from newest to oldest.
 func (m *KudoModel) User(
 	ctx context.Context,
 	creator_username string,
+	viewer string,
 	page int,
 ) ([]Kudo, error) {
 	conn, err := m.DB.Take(ctx)
@@ -293,56 +373,21 @@ func (m *KudoModel) User(
 	}
 	defer m.DB.Put(conn)
 
-	limit := PageSize
-	offset := offset(page)
-
-	var kudos []Kudo
-	err = sqlitex.Execute(conn,
-		`
-SELECT kudos.id, kudos.item_id, items.name, users.displayname,
-	profile_pictures.filename, kudos.frame, kudos.emoji, kudos.body
-FROM kudos
-JOIN users
-	ON kudos.creator_username = users.username
-LEFT JOIN profile_pictures
-	ON kudos.creator_username = profile_pictures.username
-	AND profile_pictures.kind = 1
-JOIN items
-	ON kudos.item_id = items.id
-WHERE kudos.creator_username = ? ORDER BY kudos.id DESC LIMIT ? OFFSET ?`,
-		&sqlitex.ExecOptions{
-			ResultFunc: func(stmt *sqlite.Stmt) error {
-				var k Kudo
-
-				id := stmt.ColumnText(0)
-				k.ID, err = ulid.Parse(id)
-				if err != nil {
-					return err
-				}
-
-				itemID := stmt.ColumnText(1)
-				k.ItemID, err = ulid.Parse(itemID)
-				if err != nil {
-					return err
-				}
-
-				k.ItemName = stmt.ColumnText(2)
-				k.CreatorUsername = creator_username
-				k.CreatorDisplayName = stmt.ColumnText(3)
-				k.CreatorPic = stmt.ColumnText(4)
-				k.Frame = stmt.ColumnInt(5)
-				k.Emoji = stmt.ColumnInt(6)
-				k.Body = stmt.ColumnText(7)
-
-				kudos = append(kudos, k)
-				return nil
-			},
-			Args: []any{creator_username, limit, offset},
+	return listKudos(conn,
+		`SELECT `+kudoColumns+`
+FROM kudos`+kudoJoins+`
+WHERE kudos.creator_username = :creator AND `+visibleNewestKudo+`
+ORDER BY kudos.id DESC LIMIT :limit OFFSET :offset`,
+		map[string]any{
+			":creator": creator_username,
+			":viewer":  viewer,
+			":limit":   PageSize,
+			":offset":  offset(page),
 		})
-	return kudos, err
 }
 
 // Insert a kudo.
+// The kudo's first revision is recorded with the same ID as the kudo.
 func (m *KudoModel) Insert(
 	ctx context.Context,
 	item_id ulid.ULID,
@@ -350,9 +395,12 @@ func (m *KudoModel) Insert(
 	frame int,
 	emoji int,
 	body string,
-) (ulid.ULID, error) {
-	ms := ulid.Timestamp(time.Now())
-	uuid, err := ulid.New(ms, rand.Reader)
+	warning string,
+	visibility Visibility,
+	mentions []string,
+) (uuid ulid.ULID, err error) {
+	now := time.Now()
+	uuid, err = ulid.New(ulid.Timestamp(now), rand.Reader)
 	if err != nil {
 		return uuid, err
 	}
@@ -363,9 +411,18 @@ func (m *KudoModel) Insert(
 	}
 	defer m.DB.Put(conn)
 
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return uuid, err
+	}
+	defer endFn(&err)
+
 	err = sqlitex.Execute(
 		conn,
-		`INSERT INTO kudos (id, item_id, creator_username, frame, emoji, body) VALUES (?, ?, ?, ?, ?, ?)`,
+		`INSERT INTO kudos
+		(id, item_id, creator_username, frame, emoji, body, warning,
+		visibility, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		&sqlitex.ExecOptions{Args: []any{
 			uuid,
 			item_id,
@@ -373,38 +430,159 @@ func (m *KudoModel) Insert(
 			frame,
 			emoji,
 			body,
+			warning,
+			visibility,
+			now.Unix(),
+			now.Unix(),
 		}},
 	)
+	if err != nil {
+		return uuid, err
+	}
+
+	err = insertKudoRevision(conn, KudoRevision{
+		ID:      uuid,
+		KudoID:  uuid,
+		Frame:   frame,
+		Emoji:   emoji,
+		Body:    body,
+		Warning: warning,
+	})
+	if err != nil {
+		return uuid, err
+	}
+
+	err = syncMentions(conn, uuid, creator_username, mentions)
+	if err != nil {
+		return uuid, err
+	}
+
+	// Let the item's creator know someone gave it kudos.
+	var itemCreator string
+	err = sqlitex.Execute(
+		conn,
+		`SELECT creator_username FROM items WHERE id = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				itemCreator = stmt.ColumnText(0)
+				return nil
+			},
+			Args: []any{item_id},
+		},
+	)
+	if err != nil || itemCreator == "" || itemCreator == creator_username {
+		return uuid, err
+	}
+	err = insertNotification(
+		conn,
+		itemCreator,
+		NotificationItemKudo,
+		creator_username,
+		uuid,
+	)
 	return uuid, err
 }
 
 // Update a kudo.
+// If the kudo's content changed the new version is recorded as a revision.
 func (m *KudoModel) Update(
 	ctx context.Context,
 	id ulid.ULID,
-	item_id ulid.ULID,
 	creator_username string,
 	frame int,
 	emoji int,
 	body string,
-) error {
+	warning string,
+	visibility Visibility,
+	mentions []string,
+) (err error) {
+	now := time.Now()
+	revisionID, err := ulid.New(ulid.Timestamp(now), rand.Reader)
+	if err != nil {
+		return err
+	}
+
 	conn, err := m.DB.Take(ctx)
 	if err != nil {
 		return err
 	}
 	defer m.DB.Put(conn)
 
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
+	var found bool
+	var old KudoRevision
 	err = sqlitex.Execute(
 		conn,
-		`UPDATE kudos SET item_id = ?, creator_username = ?, frame = ?, emoji = ?, body = ? WHERE id = ?`,
+		`SELECT frame, emoji, body, warning FROM kudos
+		WHERE id = ? AND creator_username = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				found = true
+				old.Frame = stmt.ColumnInt(0)
+				old.Emoji = stmt.ColumnInt(1)
+				old.Body = stmt.ColumnText(2)
+				old.Warning = stmt.ColumnText(3)
+				return nil
+			},
+			Args: []any{id, creator_username},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNoRecord
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE kudos SET visibility = ? WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{visibility, id}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Only changes to what the kudo says are part of its history.
+	if old.Frame == frame && old.Emoji == emoji && old.Body == body &&
+		old.Warning == warning {
+		return nil
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE kudos
+		SET frame = ?, emoji = ?, body = ?, warning = ?, updated_at = ?
+		WHERE id = ?`,
 		&sqlitex.ExecOptions{Args: []any{
-			item_id,
-			creator_username,
 			frame,
 			emoji,
 			body,
+			warning,
+			now.Unix(),
 			id,
 		}},
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	err = insertKudoRevision(conn, KudoRevision{
+		ID:      revisionID,
+		KudoID:  id,
+		Frame:   frame,
+		Emoji:   emoji,
+		Body:    body,
+		Warning: warning,
+	})
+	if err != nil {
+		return err
+	}
+
+	return syncMentions(conn, id, creator_username, mentions)
 }
@@ -0,0 +1,294 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+	"time"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// LoginAttempts describes the failed logins for a username.
+type LoginAttempts struct {
+	Username    string
+	Failures    int
+	LastFailure time.Time
+
+	// NextAttempt is the earliest another login may be tried.
+	NextAttempt time.Time
+
+	// LockedUntil is when a lockout ends, or the zero time if the username
+	// was never locked out.
+	LockedUntil time.Time
+}
+
+// LoginAttemptModel handles failed login storage.
+type LoginAttemptModel struct {
+	DB *sqlitex.Pool
+}
+
+const loginAttemptColumns = `username, failures, last_failure, next_attempt,
+locked_until`
+
+func scanLoginAttempts(stmt *sqlite.Stmt) LoginAttempts {
+	a := LoginAttempts{
+		Username:    stmt.ColumnText(0),
+		Failures:    stmt.ColumnInt(1),
+		LastFailure: time.Unix(stmt.ColumnInt64(2), 0),
+		NextAttempt: time.Unix(stmt.ColumnInt64(3), 0),
+	}
+	if locked := stmt.ColumnInt64(4); locked != 0 {
+		a.LockedUntil = time.Unix(locked, 0)
+	}
+	return a
+}
+
+// Reserve claims the right to try a login to a username, so each attempt is
+// counted before the next one can start. If a login can't be tried yet the
+// time it can be is returned, or ErrLoginInProgress if another one is being
+// checked. A reservation lasts until hold, or until Delay, Succeeded, or
+// Release is called.
+func (m *LoginAttemptModel) Reserve(
+	ctx context.Context,
+	username string,
+	now time.Time,
+	hold time.Time,
+) (until time.Time, err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer endFn(&err)
+
+	var next, reserved int64
+	err = sqlitex.Execute(
+		conn,
+		`SELECT max(next_attempt, locked_until), reserved_until
+		FROM login_attempts WHERE username = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				next = stmt.ColumnInt64(0)
+				reserved = stmt.ColumnInt64(1)
+				return nil
+			},
+			Args: []any{username},
+		},
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if next > now.Unix() {
+		return time.Unix(next, 0), nil
+	}
+	if reserved > now.Unix() {
+		return time.Time{}, ErrLoginInProgress
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`INSERT INTO login_attempts (username, reserved_until) VALUES (?1, ?2)
+		ON CONFLICT (username) DO UPDATE SET reserved_until = ?2`,
+		&sqlitex.ExecOptions{Args: []any{username, hold.Unix()}},
+	)
+	return time.Time{}, err
+}
+
+// Release gives up a reservation from Reserve without counting the login, such
+// as when checking it failed. It does nothing if the reservation already ended.
+func (m *LoginAttemptModel) Release(ctx context.Context, username string) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	return sqlitex.Execute(
+		conn,
+		`UPDATE login_attempts SET reserved_until = 0 WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{username}},
+	)
+}
+
+// Failed records a failed login for a username and returns how many there
+// have been. Failures from before the since time are forgotten.
+func (m *LoginAttemptModel) Failed(
+	ctx context.Context,
+	username string,
+	since time.Time,
+) (failures int, err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return 0, err
+	}
+	defer endFn(&err)
+
+	err = sqlitex.Execute(
+		conn,
+		`INSERT INTO login_attempts (username, failures, last_failure)
+		VALUES (:username, 1, :now)
+		ON CONFLICT (username) DO UPDATE SET
+			failures = iif(last_failure < :since, 1, failures + 1),
+			last_failure = :now`,
+		&sqlitex.ExecOptions{
+			Named: map[string]any{
+				":username": username,
+				":now":      time.Now().Unix(),
+				":since":    since.Unix(),
+			},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	err = sqlitex.Execute(
+		conn,
+		`SELECT failures FROM login_attempts WHERE username = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				failures = stmt.ColumnInt(0)
+				return nil
+			},
+			Args: []any{username},
+		},
+	)
+	return failures, err
+}
+
+// Delay stops logins for a username until the next attempt time and ends its
+// reservation. If locked until is not the zero time the username is also
+// locked out until then.
+func (m *LoginAttemptModel) Delay(
+	ctx context.Context,
+	username string,
+	next time.Time,
+	lockedUntil time.Time,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	var locked int64
+	if !lockedUntil.IsZero() {
+		locked = lockedUntil.Unix()
+	}
+	return sqlitex.Execute(
+		conn,
+		`UPDATE login_attempts SET
+			next_attempt = ?,
+			locked_until = iif(? = 0, locked_until, ?),
+			reserved_until = 0
+		WHERE username = ?`,
+		&sqlitex.ExecOptions{
+			Args: []any{next.Unix(), locked, locked, username},
+		},
+	)
+}
+
+// Succeeded forgets the failed logins for a username after it logged in,
+// which also ends its reservation.
+func (m *LoginAttemptModel) Succeeded(
+	ctx context.Context,
+	username string,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	return sqlitex.Execute(
+		conn,
+		`DELETE FROM login_attempts WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{username}},
+	)
+}
+
+// Limited returns the usernames which can't be logged in to right now,
+// starting with the ones waiting the longest.
+func (m *LoginAttemptModel) Limited(
+	ctx context.Context,
+	now time.Time,
+	page int,
+) ([]LoginAttempts, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.DB.Put(conn)
+
+	var attempts []LoginAttempts
+	err = sqlitex.Execute(
+		conn,
+		`SELECT `+loginAttemptColumns+` FROM login_attempts
+		WHERE max(next_attempt, locked_until) > ?
+		ORDER BY max(next_attempt, locked_until) DESC, username
+		LIMIT ? OFFSET ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				attempts = append(attempts, scanLoginAttempts(stmt))
+				return nil
+			},
+			Args: []any{now.Unix(), PageSize, offset(page)},
+		},
+	)
+	return attempts, err
+}
+
+// Clear lets a username be logged in to right away and forgets its failed
+// logins. If the username has none ErrNoRecord is returned.
+func (m *LoginAttemptModel) Clear(ctx context.Context, username string) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	err = sqlitex.Execute(
+		conn,
+		`DELETE FROM login_attempts WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{username}},
+	)
+	if err != nil {
+		return err
+	}
+	if conn.Changes() == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// Purge removes the failed logins which are forgotten because they're from
+// before the since time and aren't locked out or reserved any more.
+func (m *LoginAttemptModel) Purge(ctx context.Context, since time.Time) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	return sqlitex.Execute(
+		conn,
+		`DELETE FROM login_attempts
+		WHERE last_failure < ?1 AND locked_until < ?2 AND reserved_until < ?2`,
+		&sqlitex.ExecOptions{
+			Args: []any{since.Unix(), time.Now().Unix()},
+		},
+	)
+}
@@ -0,0 +1,252 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/oklog/ulid"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// NotificationKind is what a notification is about.
+type NotificationKind int
+
+const (
+	// NotificationMention is sent when someone mentions the user in a kudo.
+	NotificationMention NotificationKind = iota
+
+	// NotificationFollow is sent when someone follows the user.
+	NotificationFollow
+
+	// NotificationItemKudo is sent when someone gives kudos to an item the
+	// user created.
+	NotificationItemKudo
+)
+
+// Notification tells a user about something another user did.
+// The time it happened is stored in the ID.
+//
+// Kudos given to the same item are grouped into one notification, which holds
+// the newest of them along with how many there are.
+type Notification struct {
+	ID               ulid.ULID
+	Kind             NotificationKind
+	ActorUsername    string
+	ActorDisplayName string
+	Read             bool
+
+	// Count is how many notifications were grouped into this one.
+	Count int
+
+	// The kudo and item a notification is about. These are zero for follows.
+	KudoID   ulid.ULID
+	ItemID   ulid.ULID
+	ItemName string
+}
+
+// Others is how many other notifications were grouped with this one.
+func (n Notification) Others() int {
+	return n.Count - 1
+}
+
+// NotificationModel handles notification storage.
+type NotificationModel struct {
+	DB *sqlitex.Pool
+}
+
+// insertNotification records a notification for a user using an existing
+// connection so it can be part of a larger transaction.
+func insertNotification(
+	conn *sqlite.Conn,
+	username string,
+	kind NotificationKind,
+	actor string,
+	kudoID ulid.ULID,
+) error {
+	id, err := ulid.New(ulid.Timestamp(time.Now()), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	var kudo string
+	if kudoID != (ulid.ULID{}) {
+		kudo = kudoID.String()
+	}
+	return sqlitex.Execute(
+		conn,
+		`INSERT INTO notifications (id, username, kind, actor_username, kudo_id)
+		VALUES (?, ?, ?, ?, ?)`,
+		&sqlitex.ExecOptions{Args: []any{id, username, kind, actor, kudo}},
+	)
+}
+
+// notificationsShown limits a query to the :viewer's notifications which are
+// still relevant. Notifications about kudos which were deleted, or which the
+// viewer can no longer see, are left out.
+var notificationsShown = fmt.Sprintf(`notifications.username = :viewer AND (
+	notifications.kind = %d
+	OR (kudos.id IS NOT NULL AND %s)
+)`, NotificationFollow, visible("kudos"))
+
+// notificationGroup groups kudos given to the same item, as long as they were
+// all read or all unread. Other notifications are never grouped.
+var notificationGroup = fmt.Sprintf(`CASE
+	WHEN notifications.kind = %d
+	THEN 'item-' || kudos.item_id || '-' || notifications.read
+	ELSE notifications.id
+END`, NotificationItemKudo)
+
+// notificationJoins joins the tables needed to fill in a notification.
+const notificationJoins = `
+JOIN users
+	ON notifications.actor_username = users.username
+LEFT JOIN kudos
+	ON notifications.kudo_id = kudos.id
+LEFT JOIN items
+	ON kudos.item_id = items.id`
+
+// List returns a user's notifications from newest to oldest.
+func (m *NotificationModel) List(
+	ctx context.Context,
+	username string,
+	page int,
+) ([]Notification, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.DB.Put(conn)
+
+	// The other columns are taken from the newest notification in the group.
+	var notifications []Notification
+	err = sqlitex.Execute(conn,
+		`SELECT max(notifications.id), notifications.kind,
+			notifications.actor_username, users.displayname, notifications.read,
+			count(*), kudos.id, kudos.item_id, items.name
+		FROM notifications`+notificationJoins+`
+		WHERE `+notificationsShown+`
+		GROUP BY `+notificationGroup+`
+		ORDER BY max(notifications.id) DESC LIMIT :limit OFFSET :offset`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				var n Notification
+				var err error
+				n.ID, err = ulid.Parse(stmt.ColumnText(0))
+				if err != nil {
+					return err
+				}
+				n.Kind = NotificationKind(stmt.ColumnInt(1))
+				n.ActorUsername = stmt.ColumnText(2)
+				n.ActorDisplayName = stmt.ColumnText(3)
+				n.Read = stmt.ColumnBool(4)
+				n.Count = stmt.ColumnInt(5)
+				if n.Kind != NotificationFollow {
+					n.KudoID, err = ulid.Parse(stmt.ColumnText(6))
+					if err != nil {
+						return err
+					}
+					n.ItemID, err = ulid.Parse(stmt.ColumnText(7))
+					if err != nil {
+						return err
+					}
+					n.ItemName = stmt.ColumnText(8)
+				}
+				notifications = append(notifications, n)
+				return nil
+			},
+			Named: map[string]any{
+				":viewer": username,
+				":limit":  PageSize,
+				":offset": offset(page),
+			},
+		})
+	return notifications, err
+}
+
+// Unread returns how many of a user's notifications are unread, counting
+// grouped notifications once.
+func (m *NotificationModel) Unread(
+	ctx context.Context,
+	username string,
+) (int, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.DB.Put(conn)
+
+	var count int
+	err = sqlitex.Execute(conn,
+		`SELECT count(DISTINCT `+notificationGroup+`)
+		FROM notifications`+notificationJoins+`
+		WHERE `+notificationsShown+` AND notifications.read = 0`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				count = stmt.ColumnInt(0)
+				return nil
+			},
+			Named: map[string]any{":viewer": username},
+		})
+	return count, err
+}
+
+// Read marks a notification as read, along with the older notifications
+// grouped with it.
+func (m *NotificationModel) Read(
+	ctx context.Context,
+	username string,
+	id ulid.ULID,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	return sqlitex.Execute(conn,
+		`UPDATE notifications SET read = 1
+		WHERE username = :viewer AND read = 0 AND id <= :id AND (
+			id = :id OR (
+				kind = :itemKudo AND kudo_id IN (
+					SELECT grouped.id FROM kudos AS grouped
+					JOIN kudos AS newest
+						ON grouped.item_id = newest.item_id
+					JOIN notifications AS n
+						ON n.kudo_id = newest.id
+					WHERE n.id = :id AND n.kind = :itemKudo
+				)
+			)
+		)`,
+		&sqlitex.ExecOptions{
+			Named: map[string]any{
+				":viewer":   username,
+				":id":       id,
+				":itemKudo": NotificationItemKudo,
+			},
+		})
+}
+
+// ReadAll marks all of a user's notifications up to and including the given
+// one as read. Anything newer was not seen yet so it is left unread.
+func (m *NotificationModel) ReadAll(
+	ctx context.Context,
+	username string,
+	newest ulid.ULID,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	return sqlitex.Execute(conn,
+		`UPDATE notifications SET read = 1
+		WHERE username = ? AND read = 0 AND id <= ?`,
+		&sqlitex.ExecOptions{Args: []any{username, newest}},
+	)
+}
@@ -0,0 +1,289 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"time"
+
+	"github.com/oklog/ulid"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// OutboxMessage is an email waiting to be sent. The time it was queued is
+// stored in the ID.
+type OutboxMessage struct {
+	ID        ulid.ULID
+	Recipient string
+	Subject   string
+	Text      string
+	HTML      string
+
+	// Unsubscribe is a link which stops the recipient from getting messages
+	// like this one, or blank if there is none.
+	Unsubscribe string
+
+	// Attempts is how many times sending the message failed.
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+
+	// Dead messages failed too many times and are no longer retried.
+	Dead bool
+}
+
+// OutboxModel handles outbound email storage.
+type OutboxModel struct {
+	DB *sqlitex.Pool
+}
+
+const outboxColumns = `id, recipient, subject, text_body, html_body, attempts,
+next_attempt, last_error, dead, unsubscribe`
+
+func scanOutboxMessage(stmt *sqlite.Stmt) (OutboxMessage, error) {
+	var msg OutboxMessage
+	var err error
+	msg.ID, err = ulid.Parse(stmt.ColumnText(0))
+	if err != nil {
+		return msg, err
+	}
+	msg.Recipient = stmt.ColumnText(1)
+	msg.Subject = stmt.ColumnText(2)
+	msg.Text = stmt.ColumnText(3)
+	msg.HTML = stmt.ColumnText(4)
+	msg.Attempts = stmt.ColumnInt(5)
+	msg.NextAttempt = time.Unix(stmt.ColumnInt64(6), 0)
+	msg.LastError = stmt.ColumnText(7)
+	msg.Dead = stmt.ColumnBool(8)
+	msg.Unsubscribe = stmt.ColumnText(9)
+	return msg, nil
+}
+
+// Enqueue stores a message to be sent as soon as possible. Messages are
+// stored fully rendered, including any secrets such as password reset tokens.
+// If expires is not the zero time the message is deleted by Expire once it
+// passes, whether or not it was sent.
+func (m *OutboxModel) Enqueue(
+	ctx context.Context,
+	recipient string,
+	subject string,
+	text string,
+	html string,
+	unsubscribe string,
+	expires time.Time,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	now := time.Now()
+	id, err := ulid.New(ulid.Timestamp(now), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	var expiry int64
+	if !expires.IsZero() {
+		expiry = expires.Unix()
+	}
+
+	return sqlitex.Execute(
+		conn,
+		`INSERT INTO outbox (id, recipient, subject, text_body, html_body,
+			unsubscribe, next_attempt, expires)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		&sqlitex.ExecOptions{
+			Args: []any{
+				id,
+				recipient,
+				subject,
+				text,
+				html,
+				unsubscribe,
+				now.Unix(),
+				expiry,
+			},
+		},
+	)
+}
+
+// Next returns the oldest message which is due to be sent by now. If none are
+// due ErrNoRecord is returned.
+func (m *OutboxModel) Next(
+	ctx context.Context,
+	now time.Time,
+) (OutboxMessage, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+	defer m.DB.Put(conn)
+
+	var msg OutboxMessage
+	var found bool
+	err = sqlitex.Execute(
+		conn,
+		`SELECT `+outboxColumns+` FROM outbox
+		WHERE dead = 0 AND next_attempt <= ?1
+		AND (expires = 0 OR expires > ?1)
+		ORDER BY next_attempt, id LIMIT 1`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				var err error
+				msg, err = scanOutboxMessage(stmt)
+				found = true
+				return err
+			},
+			Args: []any{now.Unix()},
+		},
+	)
+	if err != nil {
+		return msg, err
+	}
+	if !found {
+		return msg, ErrNoRecord
+	}
+	return msg, nil
+}
+
+// Sent removes a message which was delivered.
+func (m *OutboxModel) Sent(ctx context.Context, id ulid.ULID) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	return sqlitex.Execute(
+		conn,
+		`DELETE FROM outbox WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{id}},
+	)
+}
+
+// Expire deletes the messages which expired by now, so the secrets in them
+// aren't kept after they stop working.
+func (m *OutboxModel) Expire(ctx context.Context, now time.Time) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	return sqlitex.Execute(
+		conn,
+		`DELETE FROM outbox WHERE expires != 0 AND expires <= ?`,
+		&sqlitex.ExecOptions{Args: []any{now.Unix()}},
+	)
+}
+
+// Failed records a failed attempt to send a message. The message is tried
+// again at the next attempt time, unless it is dead.
+func (m *OutboxModel) Failed(
+	ctx context.Context,
+	id ulid.ULID,
+	reason string,
+	next time.Time,
+	dead bool,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	return sqlitex.Execute(
+		conn,
+		`UPDATE outbox SET
+			attempts = attempts + 1,
+			next_attempt = ?,
+			last_error = ?,
+			dead = ?
+		WHERE id = ?`,
+		&sqlitex.ExecOptions{
+			Args: []any{next.Unix(), reason, dead, id},
+		},
+	)
+}
+
+// Stuck returns the messages which failed at least once, dead messages first
+// and then from oldest to newest.
+func (m *OutboxModel) Stuck(
+	ctx context.Context,
+	page int,
+) ([]OutboxMessage, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.DB.Put(conn)
+
+	var msgs []OutboxMessage
+	err = sqlitex.Execute(
+		conn,
+		`SELECT `+outboxColumns+` FROM outbox
+		WHERE attempts > 0
+		ORDER BY dead DESC, id LIMIT ? OFFSET ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				msg, err := scanOutboxMessage(stmt)
+				if err != nil {
+					return err
+				}
+				msgs = append(msgs, msg)
+				return nil
+			},
+			Args: []any{PageSize, offset(page)},
+		},
+	)
+	return msgs, err
+}
+
+// Retry schedules a stuck message to be sent right away, bringing it back if
+// it was dead. Its attempts start over.
+func (m *OutboxModel) Retry(ctx context.Context, id ulid.ULID) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE outbox SET attempts = 0, next_attempt = ?, dead = 0 WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{time.Now().Unix(), id}},
+	)
+	if err != nil {
+		return err
+	}
+	if conn.Changes() == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// Discard removes a message without sending it.
+func (m *OutboxModel) Discard(ctx context.Context, id ulid.ULID) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	err = sqlitex.Execute(
+		conn,
+		`DELETE FROM outbox WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{id}},
+	)
+	if err != nil {
+		return err
+	}
+	if conn.Changes() == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
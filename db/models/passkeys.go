@@ -0,0 +1,200 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+	"time"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// Passkey is a WebAuthn credential a user can log in with.
+type Passkey struct {
+	ID       []byte
+	Username string
+	Name     string
+
+	// PublicKey is the credential's public key in COSE_Key format.
+	PublicKey []byte
+
+	// SignCount is the last signature counter the authenticator reported.
+	SignCount uint32
+
+	Created time.Time
+
+	// LastUsed is the zero time if the passkey was never used to log in.
+	LastUsed time.Time
+}
+
+// PasskeyModel handles passkey storage.
+type PasskeyModel struct {
+	DB *sqlitex.Pool
+}
+
+const passkeyColumns = `id, username, name, public_key, sign_count, created_at,
+last_used`
+
+func scanPasskey(stmt *sqlite.Stmt) Passkey {
+	p := Passkey{
+		ID:        make([]byte, stmt.ColumnLen(0)),
+		Username:  stmt.ColumnText(1),
+		Name:      stmt.ColumnText(2),
+		PublicKey: make([]byte, stmt.ColumnLen(3)),
+		SignCount: uint32(stmt.ColumnInt64(4)),
+		Created:   time.Unix(stmt.ColumnInt64(5), 0),
+	}
+	stmt.ColumnBytes(0, p.ID)
+	stmt.ColumnBytes(3, p.PublicKey)
+	if lastUsed := stmt.ColumnInt64(6); lastUsed != 0 {
+		p.LastUsed = time.Unix(lastUsed, 0)
+	}
+	return p
+}
+
+// Insert registers a new passkey for a user.
+func (m *PasskeyModel) Insert(
+	ctx context.Context,
+	username string,
+	name string,
+	id []byte,
+	publicKey []byte,
+	signCount uint32,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	err = sqlitex.Execute(
+		conn,
+		`INSERT INTO webauthn_credentials (id, username, name, public_key,
+			sign_count, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		&sqlitex.ExecOptions{
+			Args: []any{
+				id,
+				username,
+				name,
+				publicKey,
+				int64(signCount),
+				time.Now().Unix(),
+			},
+		},
+	)
+	if sqlite.ErrCode(err) == sqlite.ResultConstraintPrimaryKey {
+		return ErrPasskeyExists
+	}
+	return err
+}
+
+// Get returns the passkey with an ID. If there is none ErrNoRecord is
+// returned.
+func (m *PasskeyModel) Get(ctx context.Context, id []byte) (Passkey, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return Passkey{}, err
+	}
+	defer m.DB.Put(conn)
+
+	var p Passkey
+	var found bool
+	err = sqlitex.Execute(
+		conn,
+		`SELECT `+passkeyColumns+` FROM webauthn_credentials WHERE id = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				p = scanPasskey(stmt)
+				found = true
+				return nil
+			},
+			Args: []any{id},
+		},
+	)
+	if err != nil {
+		return p, err
+	}
+	if !found {
+		return p, ErrNoRecord
+	}
+	return p, nil
+}
+
+// List returns a user's passkeys from oldest to newest.
+func (m *PasskeyModel) List(
+	ctx context.Context,
+	username string,
+) ([]Passkey, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.DB.Put(conn)
+
+	var passkeys []Passkey
+	err = sqlitex.Execute(
+		conn,
+		`SELECT `+passkeyColumns+` FROM webauthn_credentials
+		WHERE username = ? ORDER BY created_at, id`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				passkeys = append(passkeys, scanPasskey(stmt))
+				return nil
+			},
+			Args: []any{username},
+		},
+	)
+	return passkeys, err
+}
+
+// Used records that a passkey was used to log in, storing the signature
+// counter the authenticator reported.
+func (m *PasskeyModel) Used(
+	ctx context.Context,
+	id []byte,
+	signCount uint32,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	return sqlitex.Execute(
+		conn,
+		`UPDATE webauthn_credentials SET sign_count = ?, last_used = ?
+		WHERE id = ?`,
+		&sqlitex.ExecOptions{
+			Args: []any{int64(signCount), time.Now().Unix(), id},
+		},
+	)
+}
+
+// Delete removes one of a user's passkeys. If the user has no passkey with
+// that ID ErrNoRecord is returned.
+func (m *PasskeyModel) Delete(
+	ctx context.Context,
+	username string,
+	id []byte,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	err = sqlitex.Execute(
+		conn,
+		`DELETE FROM webauthn_credentials WHERE username = ? AND id = ?`,
+		&sqlitex.ExecOptions{Args: []any{username, id}},
+	)
+	if err != nil {
+		return err
+	}
+	if conn.Changes() == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
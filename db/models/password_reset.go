@@ -13,7 +13,8 @@ import (
 	"zombiezen.com/go/sqlite/sqlitex"
 )
 
-const pwresetTTL = 45 * time.Minute
+// PWResetTTL is how long a password reset token keeps working.
+const PWResetTTL = 45 * time.Minute
 
 type token struct {
 	Plaintext string
@@ -48,7 +49,7 @@ func (m *PWResetModel) New(
 		return "", err
 	}
 
-	token, err := generatePWResetToken(username)
+	token, err := generateToken(username, PWResetTTL)
 	if err != nil {
 		return "", err
 	}
@@ -63,11 +64,12 @@ func (m *PWResetModel) New(
 	return token.Plaintext, err
 }
 
-// generatePWResetToken generates a new password reset token for a given user.
-func generatePWResetToken(username string) (token, error) {
+// generateToken generates a new token for a given user which expires after
+// the given duration.
+func generateToken(username string, ttl time.Duration) (token, error) {
 	token := token{
 		Username: username,
-		Expiry:   time.Now().Add(pwresetTTL),
+		Expiry:   time.Now().Add(ttl),
 	}
 	randomBytes := make([]byte, 16)
 
@@ -81,9 +83,9 @@ func generatePWResetToken(username string) (token, error) {
 	// Padding not needed or wanted.
 	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
 
-	// Password reset tokens are high-entropy (128 bits) -- unlike a random
+	// These tokens are high-entropy (128 bits) -- unlike a random
 	// user's password. As a result it's sufficient to use a faster hashing
-	// algorithm rather than bcrypt.
+	// algorithm rather than argon2id.
 	// https://security.stackexchange.com/questions/151257/what-kind-of-hashing-to-use-for-storing-rest-api-tokens-in-the-database
 	hash := sha256.Sum256([]byte(token.Plaintext))
 	token.Hash = hash[:]
@@ -11,8 +11,13 @@ import (
 )
 
 type SearchItem struct {
-	ID   ulid.ULID
-	Name string
+	ID    ulid.ULID
+	Name  string
+	Kind  string
+	Cover string
+
+	// Kudos is how many kudos the viewer may see for the item.
+	Kudos int
 }
 
 type SearchUser struct {
@@ -25,7 +30,11 @@ type SearchModel struct {
 	DB *sqlitex.Pool
 }
 
-func (m *SearchModel) Items(ctx context.Context, query string) ([]SearchItem, error) {
+func (m *SearchModel) Items(
+	ctx context.Context,
+	query string,
+	viewer string,
+) ([]SearchItem, error) {
 	conn, err := m.DB.Take(ctx)
 	if err != nil {
 		return []SearchItem{}, err
@@ -34,8 +43,20 @@ func (m *SearchModel) Items(ctx context.Context, query string) ([]SearchItem, er
 
 	var items []SearchItem
 	err = sqlitex.Execute(conn,
-		`SELECT id, name FROM items_search WHERE items_search MATCH ?
-		ORDER BY bm25(items_search, 0, 1) LIMIT 100`,
+		`SELECT items_search.id, items_search.name, items.kind,
+			item_images.filename,
+			(
+				SELECT count(*) FROM kudos
+				WHERE kudos.item_id = items.id AND `+visibleNewestKudo+`
+			)
+		FROM items_search
+		JOIN items
+			ON items_search.id = items.id
+		LEFT JOIN item_images
+			ON items_search.id = item_images.item_id
+			AND item_images.kind = 1
+		WHERE items_search MATCH :query
+		ORDER BY bm25(items_search, 0, 1, 0.5) LIMIT 100`,
 		&sqlitex.ExecOptions{
 			ResultFunc: func(stmt *sqlite.Stmt) error {
 				id, err := ulid.Parse(stmt.ColumnText(0))
@@ -43,12 +64,15 @@ func (m *SearchModel) Items(ctx context.Context, query string) ([]SearchItem, er
 					return err
 				}
 				items = append(items, SearchItem{
-					ID:   id,
-					Name: stmt.ColumnText(1),
+					ID:    id,
+					Name:  stmt.ColumnText(1),
+					Kind:  stmt.ColumnText(2),
+					Cover: stmt.ColumnText(3),
+					Kudos: stmt.ColumnInt(4),
 				})
 				return nil
 			},
-			Args: []any{query},
+			Named: map[string]any{":query": query, ":viewer": viewer},
 		})
 	return items, err
 }
@@ -0,0 +1,268 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// recoveryCodes is how many recovery codes a user gets.
+const recoveryCodes = 10
+
+// TwoFactorModel handles two-factor authentication storage.
+type TwoFactorModel struct {
+	DB *sqlitex.Pool
+}
+
+// Secret returns a user's TOTP secret, or a blank string if they haven't
+// turned on two-factor authentication.
+func (m *TwoFactorModel) Secret(
+	ctx context.Context,
+	username string,
+) (string, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer m.DB.Put(conn)
+
+	var secret string
+	err = sqlitex.Execute(
+		conn,
+		`SELECT totp_secret FROM users WHERE username = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				secret = stmt.ColumnText(0)
+				return nil
+			},
+			Args: []any{username},
+		},
+	)
+	return secret, err
+}
+
+// Enable turns on two-factor authentication for a user and returns their new
+// recovery codes. The step is the time step of the code used to confirm the
+// secret, so the code can't be used again.
+func (m *TwoFactorModel) Enable(
+	ctx context.Context,
+	username string,
+	secret string,
+	step int64,
+) (codes []string, err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer endFn(&err)
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE users SET totp_secret = ?, totp_step = ? WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{secret, step, username}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRecoveryCodes(conn, username)
+}
+
+// Disable turns off two-factor authentication for a user and removes their
+// recovery codes.
+func (m *TwoFactorModel) Disable(
+	ctx context.Context,
+	username string,
+) (err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE users SET totp_secret = '', totp_step = 0 WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{username}},
+	)
+	if err != nil {
+		return err
+	}
+
+	return sqlitex.Execute(
+		conn,
+		`DELETE FROM recovery_codes WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{username}},
+	)
+}
+
+// UseStep records that a code for a time step was used. If a code for that
+// step or a later one was already used ErrInvalidCredentials is returned, so
+// an intercepted code can't be replayed.
+func (m *TwoFactorModel) UseStep(
+	ctx context.Context,
+	username string,
+	step int64,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	err = sqlitex.Execute(
+		conn,
+		`UPDATE users SET totp_step = ?
+		WHERE username = ? AND totp_secret != '' AND totp_step < ?`,
+		&sqlitex.ExecOptions{Args: []any{step, username, step}},
+	)
+	if err != nil {
+		return err
+	}
+	if conn.Changes() == 0 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// UseRecoveryCode checks a recovery code and removes it so it can't be used
+// again. If the code is wrong ErrInvalidCredentials is returned.
+func (m *TwoFactorModel) UseRecoveryCode(
+	ctx context.Context,
+	username string,
+	code string,
+) error {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Put(conn)
+
+	err = sqlitex.Execute(
+		conn,
+		`DELETE FROM recovery_codes WHERE hash = ? AND username = ?`,
+		&sqlitex.ExecOptions{
+			Args: []any{hashRecoveryCode(code), username},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if conn.Changes() == 0 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes a user has.
+func (m *TwoFactorModel) RecoveryCodesLeft(
+	ctx context.Context,
+	username string,
+) (int, error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.DB.Put(conn)
+
+	var count int
+	err = sqlitex.Execute(
+		conn,
+		`SELECT count(*) FROM recovery_codes WHERE username = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				count = stmt.ColumnInt(0)
+				return nil
+			},
+			Args: []any{username},
+		},
+	)
+	return count, err
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes with new ones and
+// returns them.
+func (m *TwoFactorModel) RegenerateRecoveryCodes(
+	ctx context.Context,
+	username string,
+) (codes []string, err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer endFn(&err)
+
+	return newRecoveryCodes(conn, username)
+}
+
+// newRecoveryCodes replaces a user's recovery codes using an existing
+// connection so it can be part of a larger transaction. Only the hashes are
+// stored and the plaintext codes are returned to be shown to the user once.
+func newRecoveryCodes(conn *sqlite.Conn, username string) ([]string, error) {
+	err := sqlitex.Execute(
+		conn,
+		`DELETE FROM recovery_codes WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{username}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodes)
+	for i := range codes {
+		randomBytes := make([]byte, 10)
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(randomBytes)
+		codes[i] = code[:8] + "-" + code[8:]
+
+		err = sqlitex.Execute(
+			conn,
+			`INSERT INTO recovery_codes (hash, username) VALUES (?, ?)`,
+			&sqlitex.ExecOptions{
+				Args: []any{hashRecoveryCode(codes[i]), username},
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode hashes a recovery code the way it is stored. Like password
+// reset tokens, recovery codes are random enough that a fast hash is fine.
+// Case, spaces, and dashes are ignored so codes are easy to type.
+func hashRecoveryCode(code string) []byte {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer(" ", "", "-", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return sum[:]
+}
@@ -7,7 +7,8 @@ import (
 	"errors"
 	"strings"
 
-	"golang.org/x/crypto/bcrypt"
+	"git.sr.ht/~kota/kudoer/db/passwd"
+	"github.com/oklog/ulid"
 	"zombiezen.com/go/sqlite"
 	"zombiezen.com/go/sqlite/sqlitex"
 )
@@ -19,6 +20,13 @@ type User struct {
 	Bio         string
 	Followers   int
 	Following   int
+
+	// EmailVerified is set once the user proved they own their email.
+	EmailVerified bool
+
+	// PendingEmail is a new address waiting to be verified before it
+	// replaces Email.
+	PendingEmail string
 }
 
 // UserModel handles user storage.
@@ -38,7 +46,8 @@ func (m *UserModel) Info(ctx context.Context, username string) (User, error) {
 	err = sqlitex.Execute(conn, `
 SELECT users.displayname, users.email, users.bio,
 sum(case when users_following.username = ?1 then 1 else 0 end),
-sum(case when users_following.following_username = ?1 then 1 else 0 end)
+sum(case when users_following.following_username = ?1 then 1 else 0 end),
+users.email_verified, users.pending_email
 FROM users
 JOIN users_following
 WHERE users.username = ?1`,
@@ -52,6 +61,9 @@ WHERE users.username = ?1`,
 
 				u.Following = stmt.ColumnInt(3)
 				u.Followers = stmt.ColumnInt(4)
+
+				u.EmailVerified = stmt.ColumnBool(5)
+				u.PendingEmail = stmt.ColumnText(6)
 				return nil
 			},
 			Args: []any{username},
@@ -167,12 +179,12 @@ func (m *UserModel) Register(
 }
 
 // Update a user's profile information in the database.
-// Not for changing the user's password. Use ChangePassword for that.
+// Not for changing the user's password or email. Use ChangePassword or
+// ChangeEmail for that.
 func (m *UserModel) UpdateProfile(
 	ctx context.Context,
 	username string,
 	displayname string,
-	email string,
 	bio string,
 ) error {
 	conn, err := m.DB.Take(ctx)
@@ -183,24 +195,113 @@ func (m *UserModel) UpdateProfile(
 
 	err = sqlitex.Execute(
 		conn,
-		`UPDATE users SET displayname = ?, email = ?, bio = ? WHERE username = ?`,
-		&sqlitex.ExecOptions{Args: []any{displayname, email, bio, username}},
+		`UPDATE users SET displayname = ?, bio = ? WHERE username = ?`,
+		&sqlitex.ExecOptions{Args: []any{displayname, bio, username}},
 	)
 	return err
 }
 
-// Follow makes a user follow another user.
+// ChangeEmail changes a user's email address and returns the address which
+// needs to be verified, if any.
+//
+// A verified address stays in use until the new one is verified, so the new
+// one is only stored as pending. Otherwise the new address replaces the old
+// one right away. Changing back to the current address cancels a pending
+// change, and a blank address removes the user's email.
+func (m *UserModel) ChangeEmail(
+	ctx context.Context,
+	username string,
+	email string,
+) (verify string, err error) {
+	conn, err := m.DB.Take(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer m.DB.Put(conn)
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return "", err
+	}
+	defer endFn(&err)
+
+	var current, pending string
+	var verified, found bool
+	err = sqlitex.Execute(
+		conn,
+		`SELECT email, email_verified, pending_email FROM users
+		WHERE username = ?`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				found = true
+				current = stmt.ColumnText(0)
+				verified = stmt.ColumnBool(1)
+				pending = stmt.ColumnText(2)
+				return nil
+			},
+			Args: []any{username},
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", ErrNoRecord
+	}
+
+	switch {
+	case email == current:
+		err = sqlitex.Execute(
+			conn,
+			`UPDATE users SET pending_email = '' WHERE username = ?`,
+			&sqlitex.ExecOptions{Args: []any{username}},
+		)
+	case email == "":
+		err = sqlitex.Execute(
+			conn,
+			`UPDATE users SET email = '', email_verified = 0, pending_email = ''
+			WHERE username = ?`,
+			&sqlitex.ExecOptions{Args: []any{username}},
+		)
+	case email == pending:
+		// Already waiting for this address to be verified.
+	case verified:
+		verify = email
+		err = sqlitex.Execute(
+			conn,
+			`UPDATE users SET pending_email = ? WHERE username = ?`,
+			&sqlitex.ExecOptions{Args: []any{email, username}},
+		)
+	default:
+		verify = email
+		err = sqlitex.Execute(
+			conn,
+			`UPDATE users SET email = ?, email_verified = 0, pending_email = ''
+			WHERE username = ?`,
+			&sqlitex.ExecOptions{Args: []any{email, username}},
+		)
+	}
+	return verify, err
+}
+
+// Follow makes a user follow another user and lets them know about it.
 func (m *UserModel) Follow(
 	ctx context.Context,
 	username string,
 	following_username string,
-) error {
+) (err error) {
 	conn, err := m.DB.Take(ctx)
 	if err != nil {
 		return err
 	}
 	defer m.DB.Put(conn)
 
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
 	err = sqlitex.Execute(
 		conn,
 		`INSERT INTO users_following (username, following_username) VALUES (?, ?)`,
@@ -211,21 +312,39 @@ func (m *UserModel) Follow(
 	if sqlite.ErrCode(err) == sqlite.ResultConstraintPrimaryKey {
 		return ErrAlreadyFollowing
 	}
-	return err
+	if err != nil {
+		return err
+	}
+
+	return insertNotification(
+		conn,
+		following_username,
+		NotificationFollow,
+		username,
+		ulid.ULID{},
+	)
 }
 
-// Unfollow stops a user following another user.
+// Unfollow stops a user following another user. The notification sent when
+// they followed is taken back, so following over and over doesn't flood the
+// other user's notifications.
 func (m *UserModel) Unfollow(
 	ctx context.Context,
 	username string,
 	following_username string,
-) error {
+) (err error) {
 	conn, err := m.DB.Take(ctx)
 	if err != nil {
 		return err
 	}
 	defer m.DB.Put(conn)
 
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
 	err = sqlitex.Execute(
 		conn,
 		`DELETE FROM users_following WHERE username = ? AND following_username = ?`,
@@ -233,7 +352,18 @@ func (m *UserModel) Unfollow(
 			Args: []any{username, following_username},
 		},
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return sqlitex.Execute(
+		conn,
+		`DELETE FROM notifications
+		WHERE username = ? AND actor_username = ? AND kind = ?`,
+		&sqlitex.ExecOptions{
+			Args: []any{following_username, username, NotificationFollow},
+		},
+	)
 }
 
 // IsFollowing checks if a user is following another user.
@@ -328,10 +458,10 @@ func (m *UserModel) Following(
 	return users, err
 }
 
-// GetEmail gets a user's email.
-// A blank string indicates that they have not set an email (or the user was not
-// found).
-func (m *UserModel) GetEmail(
+// VerifiedEmail gets a user's email if it was verified.
+// A blank string indicates that they have not set or verified an email (or the
+// user was not found).
+func (m *UserModel) VerifiedEmail(
 	ctx context.Context,
 	username string,
 ) (string, error) {
@@ -342,7 +472,8 @@ func (m *UserModel) GetEmail(
 	defer m.DB.Put(conn)
 
 	var email string
-	err = sqlitex.Execute(conn, `SELECT email from users WHERE username = ?`,
+	err = sqlitex.Execute(conn, `SELECT email from users
+		WHERE username = ? AND email_verified = 1`,
 		&sqlitex.ExecOptions{
 			ResultFunc: func(stmt *sqlite.Stmt) error {
 				email = stmt.ColumnText(0)
@@ -375,7 +506,8 @@ func (m *UserModel) ChangePassword(
 }
 
 // Authenticate checks if a given username and password are correct for the
-// user.
+// user. If they are and the stored hash is outdated it's replaced with a new
+// one.
 // Success is indicated with a nil error.
 // Failure is indicated with ErrInvalidCredentials. All other errors are server
 // errors.
@@ -409,11 +541,25 @@ func (m *UserModel) Authenticate(
 		return ErrInvalidCredentials
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	err = passwd.Verify(hashedPassword, password)
+	if errors.Is(err, passwd.ErrMismatch) {
+		return ErrInvalidCredentials
+	} else if err != nil {
+		return err
+	}
+
+	if !passwd.NeedsRehash(hashedPassword) {
+		return nil
+	}
+	newHash, err := passwd.Hash(password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return ErrInvalidCredentials
-		}
+		return err
 	}
-	return err
+
+	// Don't overwrite the password if it was changed while checking it.
+	return sqlitex.Execute(
+		conn,
+		`UPDATE users SET password = ? WHERE username = ? AND password = ?`,
+		&sqlitex.ExecOptions{Args: []any{newHash, username, hashedPassword}},
+	)
 }
@@ -0,0 +1,164 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+
+// Package passwd hashes and verifies passwords. New hashes use argon2id and
+// are stored as PHC strings. Older bcrypt hashes are still verified so they
+// can be upgraded when their user next logs in.
+package passwd
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The argon2id parameters for new hashes. These follow the second recommended
+// option in RFC 9106 for systems which can't spare gigabytes of memory. Each
+// hash needs memory KiB while it's computed, so see slots for how many may run
+// at once.
+const (
+	memory     = 64 * 1024 // KiB
+	iterations = 3
+	threads    = 4
+	saltLen    = 16
+	keyLen     = 32
+)
+
+// ErrMismatch is returned when a password doesn't match a hash.
+var ErrMismatch = errors.New("passwd: password does not match hash")
+
+// ErrUnknownHash is returned when a hash isn't in a supported format.
+var ErrUnknownHash = errors.New("passwd: unknown hash format")
+
+var encoding = base64.RawStdEncoding
+
+// slots limits how many argon2id hashes are computed at once to one per CPU.
+// Hashing more at a time wouldn't finish any sooner, and this keeps a burst of
+// logins from using more than GOMAXPROCS * 64 MiB. The rest wait their turn.
+var slots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// idKey computes an argon2id key once a slot is free.
+func idKey(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	slots <- struct{}{}
+	defer func() { <-slots }()
+	return argon2.IDKey(password, salt, time, memory, threads, keyLen)
+}
+
+// params are the argon2id parameters stored in a hash.
+type params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// Hash hashes a password with argon2id and returns it as a PHC string.
+func Hash(password string) (string, error) {
+	salt := make([]byte, saltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := idKey([]byte(password), salt, iterations, memory, threads, keyLen)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		memory,
+		iterations,
+		threads,
+		encoding.EncodeToString(salt),
+		encoding.EncodeToString(key),
+	), nil
+}
+
+// Verify checks a password against an argon2id or bcrypt hash. If the password
+// doesn't match ErrMismatch is returned. Other errors mean the hash is invalid.
+func Verify(hash, password string) error {
+	if isBcrypt(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrMismatch
+		}
+		return err
+	}
+
+	p, salt, key, err := decode(hash)
+	if err != nil {
+		return err
+	}
+	other := idKey(
+		[]byte(password),
+		salt,
+		p.time,
+		p.memory,
+		p.threads,
+		uint32(len(key)),
+	)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// NeedsRehash reports if a hash should be replaced because it uses an older
+// algorithm or parameters than Hash.
+func NeedsRehash(hash string) bool {
+	if isBcrypt(hash) {
+		return true
+	}
+	p, salt, key, err := decode(hash)
+	if err != nil {
+		return true
+	}
+	return p != params{memory: memory, time: iterations, threads: threads} ||
+		len(salt) != saltLen ||
+		len(key) != keyLen
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") ||
+		strings.HasPrefix(hash, "$2b$") ||
+		strings.HasPrefix(hash, "$2y$")
+}
+
+// decode parses an argon2id PHC string.
+func decode(hash string) (params, []byte, []byte, error) {
+	var p params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	_, err = fmt.Sscanf(
+		parts[3],
+		"m=%d,t=%d,p=%d",
+		&p.memory,
+		&p.time,
+		&p.threads,
+	)
+	if err != nil || p.memory == 0 || p.time == 0 || p.threads == 0 {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnknownHash
+	}
+	return p, salt, key, nil
+}
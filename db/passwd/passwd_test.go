@@ -0,0 +1,132 @@
+package passwd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerify(t *testing.T) {
+	current, err := Hash("hunter12")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hashes made before passwords were upgraded to argon2id.
+	old, err := bcrypt.GenerateFromPassword([]byte("hunter12"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A hash made with weaker parameters than the current ones.
+	salt := []byte("0123456789abcdef")
+	weak := fmt.Sprintf(
+		"$argon2id$v=19$m=1024,t=1,p=1$%s$%s",
+		encoding.EncodeToString(salt),
+		encoding.EncodeToString(argon2.IDKey([]byte("hunter12"), salt, 1, 1024, 1, 32)),
+	)
+
+	long := strings.Repeat("correct horse battery staple ", 10)
+	longHash, err := Hash(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type test struct {
+		description string
+		hash        string
+		password    string
+		err         error
+		rehash      bool
+	}
+
+	tests := []test{
+		{
+			description: "Current hash",
+			hash:        current,
+			password:    "hunter12",
+			err:         nil,
+			rehash:      false,
+		},
+		{
+			description: "Current hash wrong password",
+			hash:        current,
+			password:    "hunter21",
+			err:         ErrMismatch,
+			rehash:      false,
+		},
+		{
+			description: "Bcrypt hash",
+			hash:        string(old),
+			password:    "hunter12",
+			err:         nil,
+			rehash:      true,
+		},
+		{
+			description: "Bcrypt hash wrong password",
+			hash:        string(old),
+			password:    "hunter21",
+			err:         ErrMismatch,
+			rehash:      true,
+		},
+		{
+			description: "Weak parameters",
+			hash:        weak,
+			password:    "hunter12",
+			err:         nil,
+			rehash:      true,
+		},
+		{
+			description: "Longer than bcrypt allows",
+			hash:        longHash,
+			password:    long,
+			err:         nil,
+			rehash:      false,
+		},
+		{
+			description: "Longer than bcrypt allows wrong ending",
+			hash:        longHash,
+			password:    long[:len(long)-1],
+			err:         ErrMismatch,
+			rehash:      false,
+		},
+		{
+			description: "Unknown format",
+			hash:        "$scrypt$ln=16,r=8,p=1$c2FsdA$aGFzaA",
+			password:    "hunter12",
+			err:         ErrUnknownHash,
+			rehash:      true,
+		},
+	}
+
+	for _, tc := range tests {
+		err := Verify(tc.hash, tc.password)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%v: got: %v want: %v\n", tc.description, err, tc.err)
+		}
+		if got := NeedsRehash(tc.hash); got != tc.rehash {
+			t.Fatalf("%v: got rehash: %v want: %v\n", tc.description, got, tc.rehash)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	a, err := Hash("hunter12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Hash("hunter12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Fatalf("hashes of the same password should be salted: %v\n", a)
+	}
+	if !strings.HasPrefix(a, "$argon2id$v=19$m=65536,t=3,p=4$") {
+		t.Fatalf("unexpected hash format: %v\n", a)
+	}
+}
@@ -3,7 +3,6 @@ module git.sr.ht/~kota/kudoer
 go 1.22.3
 
 require (
-	git.sr.ht/~kota/zqlsession v1.0.0
 	github.com/BurntSushi/toml v1.4.0
 	github.com/alexedwards/scs/v2 v2.8.0
 	github.com/disintegration/imaging v1.6.2
@@ -12,6 +11,7 @@ require (
 	github.com/justinas/nosurf v1.1.1
 	github.com/muesli/smartcrop v0.3.0
 	github.com/oklog/ulid v1.3.1
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/throttled/throttled/v2 v2.12.0
 	golang.org/x/crypto v0.27.0
 	zombiezen.com/go/sqlite v1.4.0
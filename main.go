@@ -9,16 +9,18 @@ import (
 	"net/http"
 	"os"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	"git.sr.ht/~kota/kudoer/application"
 	"git.sr.ht/~kota/kudoer/application/mail"
 	"git.sr.ht/~kota/kudoer/application/media"
+	"git.sr.ht/~kota/kudoer/application/webauthn"
 	"git.sr.ht/~kota/kudoer/config"
 	"git.sr.ht/~kota/kudoer/db"
+	"git.sr.ht/~kota/kudoer/db/litesession"
 	"git.sr.ht/~kota/kudoer/db/models"
 	"git.sr.ht/~kota/kudoer/ui"
-	"git.sr.ht/~kota/zqlsession"
 	"github.com/alexedwards/scs/v2"
 	"github.com/throttled/throttled/v2"
 	throttledstore "github.com/throttled/throttled/v2/store/memstore"
@@ -51,13 +53,34 @@ func main() {
 		}
 	}()
 
-	mailer := mail.New(
-		cfg.MailHost,
-		cfg.MailPort,
-		cfg.MailUsername,
-		cfg.MailPassword,
+	var transport mail.Transport
+	switch cfg.MailTransport {
+	case "sendmail":
+		transport = &mail.Sendmail{Path: cfg.MailSendmail}
+	case "dir":
+		transport = &mail.Dir{Path: cfg.MailDir}
+	default:
+		transport = mail.NewSMTP(
+			cfg.MailHost,
+			cfg.MailPort,
+			cfg.MailUsername,
+			cfg.MailPassword,
+		)
+	}
+	mailer, err := mail.New(
+		transport,
+		&models.OutboxModel{DB: db},
 		cfg.MailSender,
+		cfg.BaseURL,
 	)
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
+	relyingParty, err := webauthn.NewConfig(cfg.BaseURL)
+	if err != nil {
+		errLog.Fatal(err)
+	}
 
 	mediaStore, err := media.Open(cfg.MSN)
 	if err != nil {
@@ -70,8 +93,10 @@ func main() {
 	}
 
 	// Setup session storage.
+	sessionStore := litesession.New(db)
+	sessionStore.UsernameKey = "authenticatedUsername"
 	sessionManager := scs.New()
-	sessionManager.Store = zqlsession.New(db)
+	sessionManager.Store = sessionStore
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.ErrorFunc = func(
 		w http.ResponseWriter,
@@ -87,6 +112,12 @@ func main() {
 		)
 	}
 
+	// The config was already checked when it was loaded.
+	trustedProxies, err := cfg.Proxies()
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
 	// Set up HTTP request throttling.
 	tstore, err := throttledstore.NewCtx(65536)
 	if err != nil {
@@ -112,17 +143,31 @@ func main() {
 	app := application.New(
 		infoLog,
 		errLog,
+		strings.TrimSuffix(cfg.BaseURL, "/"),
+		cfg.Admins,
+		cfg.AllowRevisits,
+		trustedProxies,
 		templates,
 		sessionManager,
+		sessionStore,
 		rateLimiter,
 		mediaStore,
 		mailer,
+		relyingParty,
 		&models.UserModel{DB: db},
 		&models.ItemModel{DB: db},
 		&models.KudoModel{DB: db},
 		&models.SearchModel{DB: db},
 		&models.PWResetModel{DB: db},
 		&models.ProfilePictureModel{DB: db},
+		&models.ItemImageModel{DB: db},
+		&models.NotificationModel{DB: db},
+		&models.DigestModel{DB: db},
+		&models.OutboxModel{DB: db},
+		&models.VerificationModel{DB: db},
+		&models.TwoFactorModel{DB: db},
+		&models.PasskeyModel{DB: db},
+		&models.LoginAttemptModel{DB: db},
 	)
 
 	err = app.Serve(cfg.Addr)
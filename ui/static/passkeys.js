@@ -0,0 +1,114 @@
+// License: AGPL-3.0-only
+// (c) 2024 Dakota Walsh <kota@nilsu.org>
+
+// Passkey forms carry the ceremony options in data attributes. Submitting one
+// asks the browser for a passkey and then posts its response in the form's
+// hidden inputs. The content security policy doesn't allow requests from
+// scripts so the challenge is made when the page is rendered.
+
+function fromBase64URL(s) {
+	s = s.replace(/-/g, "+").replace(/_/g, "/");
+	s = s.padEnd(s.length + ((4 - (s.length % 4)) % 4), "=");
+	return Uint8Array.from(atob(s), (c) => c.charCodeAt(0));
+}
+
+function toBase64URL(buf) {
+	let s = String.fromCharCode(...new Uint8Array(buf));
+	return btoa(s).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function passkeyError(form, message) {
+	let error = form.querySelector(".passkey-error");
+	error.textContent = message;
+	error.classList.remove("undisplay");
+}
+
+let login = document.getElementById("passkey-login");
+if (login && window.PublicKeyCredential) {
+	login.classList.remove("undisplay");
+	login.addEventListener("submit", async (event) => {
+		event.preventDefault();
+		let cred;
+		try {
+			cred = await navigator.credentials.get({
+				publicKey: {
+					challenge: fromBase64URL(login.dataset.challenge),
+					rpId: login.dataset.rpId,
+					userVerification: "preferred",
+				},
+			});
+		} catch (err) {
+			passkeyError(login, "Your browser didn't use a passkey.");
+			return;
+		}
+
+		let remember = document.getElementById("remember");
+		login.elements.remember.disabled = !(remember && remember.checked);
+		login.elements.id.value = toBase64URL(cred.rawId);
+		login.elements.clientDataJSON.value = toBase64URL(
+			cred.response.clientDataJSON,
+		);
+		login.elements.authenticatorData.value = toBase64URL(
+			cred.response.authenticatorData,
+		);
+		login.elements.signature.value = toBase64URL(cred.response.signature);
+		if (cred.response.userHandle) {
+			login.elements.userHandle.value = toBase64URL(
+				cred.response.userHandle,
+			);
+		}
+		login.submit();
+	});
+}
+
+let register = document.getElementById("passkey-register");
+if (register && window.PublicKeyCredential) {
+	register.classList.remove("undisplay");
+	register.addEventListener("submit", async (event) => {
+		event.preventDefault();
+		let user = register.dataset.user;
+		let exclude = register.dataset.exclude.split(" ").filter((id) => id);
+		let cred;
+		try {
+			cred = await navigator.credentials.create({
+				publicKey: {
+					challenge: fromBase64URL(register.dataset.challenge),
+					rp: { id: register.dataset.rpId, name: "Kudoer" },
+					user: {
+						id: new TextEncoder().encode(user),
+						name: user,
+						displayName: user,
+					},
+					pubKeyCredParams: register.dataset.algorithms
+						.split(" ")
+						.map((alg) => ({ type: "public-key", alg: Number(alg) })),
+					excludeCredentials: exclude.map((id) => ({
+						type: "public-key",
+						id: fromBase64URL(id),
+					})),
+					authenticatorSelection: {
+						residentKey: "required",
+						userVerification: "preferred",
+					},
+					attestation: "none",
+				},
+			});
+		} catch (err) {
+			passkeyError(register, "Your browser didn't create a passkey.");
+			return;
+		}
+
+		register.elements.clientDataJSON.value = toBase64URL(
+			cred.response.clientDataJSON,
+		);
+		register.elements.attestationObject.value = toBase64URL(
+			cred.response.attestationObject,
+		);
+		register.submit();
+	});
+}
+
+let unsupported = document.getElementById("passkey-unsupported");
+if (unsupported && !window.PublicKeyCredential) {
+	unsupported.classList.remove("undisplay");
+}
@@ -15,6 +15,8 @@ import (
 	"strconv"
 
 	"git.sr.ht/~kota/kudoer/application/emoji"
+	"git.sr.ht/~kota/kudoer/application/kinds"
+	"git.sr.ht/~kota/kudoer/application/markup"
 	"github.com/oklog/ulid"
 )
 
@@ -93,12 +95,15 @@ func Templates() (map[string]*template.Template, error) {
 
 		ts, err := template.New(baseTMPL).
 			Funcs(template.FuncMap{
-				"PrevPage": PrevPage,
-				"NextPage": NextPage,
-				"Date":     Date,
-				"ToHash":   ToHash,
-				"FromHash": FromHash,
-				"EmojiAlt": emoji.Alt,
+				"PrevPage":       PrevPage,
+				"NextPage":       NextPage,
+				"Date":           Date,
+				"ToHash":         ToHash,
+				"FromHash":       FromHash,
+				"EmojiAlt":       emoji.Alt,
+				"KindName":       kinds.Name,
+				"Markup":         markup.Render,
+				"MarkupMentions": markup.RenderMentions,
 			}).
 			ParseFS(EFS, files...)
 		if err != nil {